@@ -0,0 +1,94 @@
+package base
+
+import (
+	"math"
+	"raytracer/textures"
+)
+
+// Accumulator is a float buffer that sums the radiance samples taken for each
+// pixel, so an image can be built up over several passes. It also keeps a
+// running mean and variance of the luminance of the samples of every pixel,
+// which is used to estimate how far the pixel is from converging.
+type Accumulator struct {
+	width, height int
+	sum           []textures.Color
+	count         []int
+	mean, m2      []float64
+}
+
+// NewAccumulator returns an empty accumulator for a width x height image.
+func NewAccumulator(width, height int) *Accumulator {
+	n := width * height
+	return &Accumulator{width, height, make([]textures.Color, n), make([]int, n),
+		make([]float64, n), make([]float64, n)}
+}
+
+// AddSample adds a single radiance sample to pixel (i, j).
+func (a *Accumulator) AddSample(i, j int, c textures.Color) {
+	// Welford's online algorithm.
+	k := j*a.width + i
+	a.sum[k] = a.sum[k].Add(c)
+	a.count[k]++
+	delta := c.Luminance() - a.mean[k]
+	a.mean[k] += delta / float64(a.count[k])
+	a.m2[k] += delta * (c.Luminance() - a.mean[k])
+}
+
+// Merge adds the samples of b to the pixels of a, with the upper left pixel
+// of b landing on pixel (x0, y0) of a.
+func (a *Accumulator) Merge(b *Accumulator, x0, y0 int) {
+	for j := 0; j < b.height; j++ {
+		for i := 0; i < b.width; i++ {
+			kb := j*b.width + i
+			if b.count[kb] == 0 {
+				continue
+			}
+			k := (j+y0)*a.width + i + x0
+			// Parallel variant of Welford's algorithm by Chan et al.
+			na := float64(a.count[k])
+			nb := float64(b.count[kb])
+			n := na + nb
+			delta := b.mean[kb] - a.mean[k]
+			a.mean[k] += delta * nb / n
+			a.m2[k] += b.m2[kb] + delta*delta*na*nb/n
+			a.sum[k] = a.sum[k].Add(b.sum[kb])
+			a.count[k] += b.count[kb]
+		}
+	}
+}
+
+// Count returns the number of samples taken for pixel (i, j).
+func (a *Accumulator) Count(i, j int) int {
+	return a.count[j*a.width+i]
+}
+
+// Mean returns the average radiance of pixel (i, j).
+func (a *Accumulator) Mean(i, j int) textures.Color {
+	k := j*a.width + i
+	if a.count[k] == 0 {
+		return textures.Black
+	}
+	return a.sum[k].DivideScalar(float64(a.count[k]))
+}
+
+// Variance returns the sample variance of the luminance of pixel (i, j).
+func (a *Accumulator) Variance(i, j int) float64 {
+	k := j*a.width + i
+	if a.count[k] < 2 {
+		return 0
+	}
+	return a.m2[k] / float64(a.count[k]-1)
+}
+
+// Error estimates the relative error of pixel (i, j) as the standard error of
+// its mean luminance divided by the mean luminance. Pixels with less than two
+// samples have an infinite error.
+func (a *Accumulator) Error(i, j int) float64 {
+	k := j*a.width + i
+	if a.count[k] < 2 {
+		return math.Inf(1)
+	}
+	stdErr := math.Sqrt(a.Variance(i, j) / float64(a.count[k]))
+	// Keeps nearly black pixels from demanding endless samples.
+	return stdErr / math.Max(a.mean[k], 0.01)
+}
@@ -0,0 +1,37 @@
+package base
+
+import (
+	"math"
+	"raytracer/textures"
+	"testing"
+)
+
+func TestAccumulatorMerge(t *testing.T) {
+	values := []float64{0.1, 0.5, 0.9, 0.3, 0.7, 0.2}
+	whole := NewAccumulator(1, 1)
+	merged := NewAccumulator(2, 2)
+	tile := NewAccumulator(1, 1)
+	for i, v := range values {
+		c := textures.NewColor(v, v, v)
+		whole.AddSample(0, 0, c)
+		if i < 2 {
+			merged.AddSample(1, 1, c)
+		} else {
+			tile.AddSample(0, 0, c)
+		}
+	}
+	merged.Merge(tile, 1, 1)
+
+	if merged.Count(1, 1) != whole.Count(0, 0) {
+		t.Errorf("count %d != %d", merged.Count(1, 1), whole.Count(0, 0))
+	}
+	if math.Abs(merged.Variance(1, 1)-whole.Variance(0, 0)) > 1e-12 {
+		t.Errorf("variance %f != %f", merged.Variance(1, 1), whole.Variance(0, 0))
+	}
+	if math.Abs(merged.Mean(1, 1).R-whole.Mean(0, 0).R) > 1e-12 {
+		t.Errorf("mean %f != %f", merged.Mean(1, 1).R, whole.Mean(0, 0).R)
+	}
+	if merged.Count(0, 0) != 0 {
+		t.Errorf("merge touched pixel (0, 0)")
+	}
+}
@@ -0,0 +1,173 @@
+package base
+
+import (
+	"errors"
+	"math"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"sort"
+)
+
+// Keyframe is where a camera is and what it looks at at a point in time.
+type Keyframe struct {
+	Time               float64
+	Origin, LookAt, Up primitives.Vec3
+	// VFOV is the vertical field of view in degrees.
+	VFOV float64
+}
+
+// AnimatedCamera is a perspective camera that moves through its keyframes.
+// The origin and the look at point follow a Catmull-Rom spline through the
+// keyframes, the up direction and the field of view are blended linearly.
+// Every ray sees the camera where it is at the time of the ray, so a camera
+// that moves while the shutter is open blurs the image.
+type AnimatedCamera struct {
+	keys   []Keyframe
+	aspect float64
+	t0, t1 float64
+	// lens holds the settings of the thin lens, its view only sets the
+	// aspect ratio the cat's eye vignetting follows.
+	lens Camera
+}
+
+// NewAnimatedCamera returns a camera that moves through keys for images with
+// the aspect ratio width / height. It focuses on its look at point with a
+// lens of the given aperture, whose depth of field shows once blur is
+// toggled on. Times before the first keyframe or after the last hold the
+// camera still.
+func NewAnimatedCamera(keys []Keyframe, aspect, aperture, t0, t1 float64) (*AnimatedCamera, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("animated camera has no keyframes")
+	}
+	sorted := append([]Keyframe(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time < sorted[j].Time })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Time == sorted[i-1].Time {
+			return nil, errors.New("animated camera has two keyframes at the same time")
+		}
+	}
+	lens := Camera{horizontal: primitives.UnitX.MultiplyScalar(aspect), vertical: primitives.UnitY,
+		lensRadius: aperture / 2}
+	return &AnimatedCamera{sorted, aspect, t0, t1, lens}, nil
+}
+
+// Shutter returns the interval the camera is open.
+func (c *AnimatedCamera) Shutter() (float64, float64) {
+	return c.t0, c.t1
+}
+
+// Span returns the times of the first and the last keyframe.
+func (c *AnimatedCamera) Span() (float64, float64) {
+	return c.keys[0].Time, c.keys[len(c.keys)-1].Time
+}
+
+// Frame returns the camera with its shutter open from t0 to t1, which
+// renders one frame of the animation.
+func (c *AnimatedCamera) Frame(t0, t1 float64) *AnimatedCamera {
+	frame := *c
+	frame.t0, frame.t1 = t0, t1
+	return &frame
+}
+
+// ToggleBlur turns blur to on if off and vice versa.
+func (c *AnimatedCamera) ToggleBlur() bool {
+	return c.lens.ToggleBlur()
+}
+
+// SetAperture sets the shape of the lens, see Camera.SetAperture.
+func (c *AnimatedCamera) SetAperture(aperture Aperture) {
+	c.lens.SetAperture(aperture)
+}
+
+// SetAnamorphic squeezes the lens horizontally, see Camera.SetAnamorphic.
+func (c *AnimatedCamera) SetAnamorphic(squeeze float64) {
+	c.lens.SetAnamorphic(squeeze)
+}
+
+// SetCatsEye turns on optical vignetting, see Camera.SetCatsEye.
+func (c *AnimatedCamera) SetCatsEye(amount float64) {
+	c.lens.SetCatsEye(amount)
+}
+
+// GetRay returns the ray through the film position (u, v) of the camera at a
+// time within the shutter interval, or nil if it is vignetted.
+func (c *AnimatedCamera) GetRay(u, v float64, sampler sampling.Sampler) *primitives.Ray {
+	r, _ := c.GetWeightedRay(u, v, sampler)
+	return r
+}
+
+// GetWeightedRay returns the ray through the film position (u, v) of the
+// camera at a time within the shutter interval, which is blocked when it
+// misses the barrel of a vignetting lens.
+func (c *AnimatedCamera) GetWeightedRay(u, v float64, sampler sampling.Sampler) (*primitives.Ray, float64) {
+	t := c.t0 + sampler.Get1D()*(c.t1-c.t0)
+	k := c.interpolate(t)
+	w := k.Origin.Subtract(k.LookAt)
+	focus := w.Magnitude()
+	w = w.DivideScalar(focus)
+	right := k.Up.Cross(w).Normalize()
+	up := w.Cross(right)
+	halfHeight := math.Tan(k.VFOV*math.Pi/360) * focus
+	halfWidth := c.aspect * halfHeight
+	target := k.LookAt.
+		Add(right.MultiplyScalar((2*u - 1) * halfWidth)).
+		Add(up.MultiplyScalar((2*v - 1) * halfHeight))
+	origin := k.Origin
+	if c.lens.blur {
+		x, y, ok := c.lens.lensPoint(u, v, sampler)
+		if !ok {
+			return nil, 0
+		}
+		origin = origin.Add(right.MultiplyScalar(x * c.lens.lensRadius)).
+			Add(up.MultiplyScalar(y * c.lens.lensRadius))
+	}
+	return primitives.NewRay(origin, target.Subtract(origin), primitives.WithTime(t)), 1
+}
+
+// interpolate returns the keyframe at time t.
+func (c *AnimatedCamera) interpolate(t float64) Keyframe {
+	last := len(c.keys) - 1
+	if t <= c.keys[0].Time {
+		return c.keys[0]
+	}
+	if t >= c.keys[last].Time {
+		return c.keys[last]
+	}
+	i := sort.Search(last, func(i int) bool { return c.keys[i+1].Time > t })
+	k0, k1 := c.keys[i], c.keys[i+1]
+	s := (t - k0.Time) / (k1.Time - k0.Time)
+	return Keyframe{
+		Time:   t,
+		Origin: c.spline(i, s, func(k Keyframe) primitives.Vec3 { return k.Origin }),
+		LookAt: c.spline(i, s, func(k Keyframe) primitives.Vec3 { return k.LookAt }),
+		Up:     k0.Up.MultiplyScalar(1 - s).Add(k1.Up.MultiplyScalar(s)),
+		VFOV:   k0.VFOV + s*(k1.VFOV-k0.VFOV),
+	}
+}
+
+// spline returns the point s of the way from keyframe i to the next on the
+// Catmull-Rom spline through the points of the keyframes that field picks.
+func (c *AnimatedCamera) spline(i int, s float64, field func(Keyframe) primitives.Vec3) primitives.Vec3 {
+	dt := c.keys[i+1].Time - c.keys[i].Time
+	p0, p1 := field(c.keys[i]), field(c.keys[i+1])
+	m0, m1 := c.tangent(i, field), c.tangent(i+1, field)
+	s2, s3 := s*s, s*s*s
+	return p0.MultiplyScalar(2*s3 - 3*s2 + 1).
+		Add(m0.MultiplyScalar((s3 - 2*s2 + s) * dt)).
+		Add(p1.MultiplyScalar(-2*s3 + 3*s2)).
+		Add(m1.MultiplyScalar((s3 - s2) * dt))
+}
+
+// tangent returns the velocity of the spline at keyframe i, from the
+// keyframes on either side of it, or the one next to it at the ends.
+func (c *AnimatedCamera) tangent(i int, field func(Keyframe) primitives.Vec3) primitives.Vec3 {
+	prev, next := i-1, i+1
+	if prev < 0 {
+		prev = i
+	}
+	if next >= len(c.keys) {
+		next = i
+	}
+	return field(c.keys[next]).Subtract(field(c.keys[prev])).
+		DivideScalar(c.keys[next].Time - c.keys[prev].Time)
+}
@@ -0,0 +1,84 @@
+package base
+
+import (
+	"math"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"testing"
+)
+
+func TestAnimatedCamera(t *testing.T) {
+	keys := []Keyframe{
+		{2, primitives.NewVec3(4, 0, 0), primitives.NewVec3(4, 0, -1), primitives.UnitY, 40},
+		{0, primitives.NewVec3(0, 0, 0), primitives.NewVec3(0, 0, -1), primitives.UnitY, 20},
+		{1, primitives.NewVec3(1, 0, 0), primitives.NewVec3(1, 0, -1), primitives.UnitY, 30},
+	}
+	camera, err := NewAnimatedCamera(keys, 1, 0, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if t0, t1 := camera.Span(); t0 != 0 || t1 != 2 {
+		t.Errorf("keyframes span %v to %v, want 0 to 2", t0, t1)
+	}
+	for _, k := range keys {
+		if got := camera.interpolate(k.Time); got.Origin.Subtract(k.Origin).Magnitude() > 1e-9 || got.VFOV != k.VFOV {
+			t.Errorf("camera at %v is %v, want %v", k.Time, got, k)
+		}
+	}
+	if k := camera.interpolate(-1); k.Origin.Subtract(keys[1].Origin).Magnitude() > 1e-9 {
+		t.Errorf("camera before the first keyframe is at %v", k.Origin)
+	}
+	// The spline leaves the middle keyframe with the average velocity of its
+	// neighbours, slower than the straight line to the last one.
+	if k := camera.interpolate(1.5); math.Abs(k.Origin.X()-2.375) > 1e-9 || math.Abs(k.VFOV-35) > 1e-9 {
+		t.Errorf("camera at 1.5 is %v", k)
+	}
+
+	// Every ray starts where the camera is at its time.
+	sampler := sampling.NewIndependent(1)
+	frame := camera.Frame(0.25, 0.75)
+	for i := 0; i < 20; i++ {
+		sampler.StartSample(0, 0, i)
+		r := frame.GetRay(0.5, 0.5, sampler)
+		if r.Time() < 0.25 || r.Time() > 0.75 {
+			t.Errorf("ray at %v is outside the shutter", r.Time())
+		}
+		want := camera.interpolate(r.Time()).Origin
+		if r.Origin().Subtract(want).Magnitude() > 1e-9 {
+			t.Errorf("ray at %v starts at %v, want %v", r.Time(), r.Origin(), want)
+		}
+	}
+
+	// With blur the rays through the center leave from all over the squeezed
+	// lens and meet at the point the camera looks at.
+	lens, err := NewAnimatedCamera(keys, 1, 0.5, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lens.ToggleBlur()
+	lens.SetAnamorphic(2)
+	var spread float64
+	for i := 0; i < 50; i++ {
+		sampler.StartSample(0, 0, i)
+		r := lens.GetRay(0.5, 0.5, sampler)
+		k := camera.interpolate(r.Time())
+		offset := r.Origin().Subtract(k.Origin)
+		if math.Abs(offset.X()) > 0.125+1e-9 || math.Abs(offset.Y()) > 0.25+1e-9 {
+			t.Errorf("ray at %v leaves the lens at %v", r.Time(), offset)
+		}
+		spread = math.Max(spread, offset.Magnitude())
+		p := r.PointAt((k.LookAt.Z() - r.Origin().Z()) / r.Direction().Z())
+		if p.Subtract(k.LookAt).Magnitude() > 1e-9 {
+			t.Errorf("ray at %v crosses the plane of focus at %v, want %v", r.Time(), p, k.LookAt)
+		}
+	}
+	if spread < 0.05 {
+		t.Errorf("rays leave the lens at most %v from its center", spread)
+	}
+	if _, err := NewAnimatedCamera(nil, 1, 0, 0, 1); err == nil {
+		t.Error("made a camera without keyframes")
+	}
+	if _, err := NewAnimatedCamera(append(keys, keys[0]), 1, 0, 0, 1); err == nil {
+		t.Error("made a camera with two keyframes at the same time")
+	}
+}
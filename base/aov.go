@@ -0,0 +1,225 @@
+package base
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"raytracer/materials"
+	"raytracer/postprocess"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"raytracer/textures"
+	"strings"
+)
+
+// AOV is an arbitrary output variable, an auxiliary image that is rendered
+// along with the image for compositing and denoising.
+type AOV int
+
+// The supported AOVs. Direct is the light that reaches the camera after at
+// most one bounce, indirect is the rest, together they add up to the image.
+const (
+	AOVDepth AOV = iota
+	AOVNormal
+	AOVAlbedo
+	AOVMaterialID
+	AOVObjectID
+	AOVDirect
+	AOVIndirect
+	numAOVs
+)
+
+var aovNames = [numAOVs]string{"depth", "normal", "albedo", "material", "object",
+	"direct", "indirect"}
+
+// aovChannels are the names of the channels of each AOV in OpenEXR files,
+// which store the red, green and blue components of the AOV's film.
+var aovChannels = [numAOVs][]string{{"Z"}, {"X", "Y", "Z"}, {"R", "G", "B"},
+	{"ID"}, {"ID"}, {"R", "G", "B"}, {"R", "G", "B"}}
+
+func (a AOV) String() string {
+	return aovNames[a]
+}
+
+// ParseAOVs returns the AOVs in a comma separated list of names: depth,
+// normal, albedo, material, object, direct and indirect, or all of them.
+func ParseAOVs(list string) ([]AOV, error) {
+	var aovs []AOV
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "all" {
+			for a := AOV(0); a < numAOVs; a++ {
+				aovs = append(aovs, a)
+			}
+			continue
+		}
+		found := false
+		for a, n := range aovNames {
+			if n == name {
+				aovs = append(aovs, AOV(a))
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown aov %q", name)
+		}
+	}
+	return aovs, nil
+}
+
+func containsAOV(aovs []AOV, a AOV) bool {
+	for _, b := range aovs {
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// AOVRecord collects the auxiliary values of a camera ray while the
+// integrator computes the radiance along it.
+type AOVRecord struct {
+	hit              bool
+	depth            float64
+	normal           primitives.Vec3
+	albedo           textures.Color
+	material         materials.Material
+	object           int
+	direct, indirect textures.Color
+}
+
+// UpdateHit records the first surface the camera ray hit, at distance depth
+// from the camera.
+func (a *AOVRecord) UpdateHit(depth float64, normal primitives.Vec3, albedo textures.Color, material materials.Material, object int) {
+	a.hit = true
+	a.depth = depth
+	a.normal = normal
+	a.albedo = albedo
+	a.material = material
+	a.object = object
+}
+
+// AddLight records radiance that reached the camera after the given number of
+// bounces.
+func (a *AOVRecord) AddLight(bounces int, c textures.Color) {
+	if bounces <= 1 {
+		a.direct = a.direct.Add(c)
+	} else {
+		a.indirect = a.indirect.Add(c)
+	}
+}
+
+// newAOVFilms creates a film for every AOV the scene renders and adds the ones
+// it saves to the image as OpenEXR layers. The light AOVs are filtered and
+// tone mapped like the image, the others average the samples inside each
+// pixel.
+func (s *Scene) newAOVFilms() {
+	for _, a := range s.aovs {
+		film := NewFilm(s.film.Width(), s.film.Height())
+		if a == AOVDirect || a == AOVIndirect {
+			film.SetFilter(s.film.filter)
+			film.SetToneMapping(s.film.toneMapping)
+		}
+		s.aovFilms[a] = film
+	}
+	s.film.layers = nil
+	for _, a := range s.outputAOVs {
+		s.film.layers = append(s.film.layers, layer{a.String(), aovChannels[a], s.aovFilms[a]})
+	}
+}
+
+// addAOVs adds sample k of a pixel, taken at film position (x, y), to the AOV
+// tiles. The IDs are taken from the first sample of the pixel since averaging
+// them would be meaningless.
+func (s *Scene) addAOVs(tiles *[numAOVs]*filmTile, aov *AOVRecord, x, y float64, k int) {
+	for _, a := range s.aovs {
+		var c textures.Color
+		switch a {
+		case AOVDirect:
+			c = aov.direct
+		case AOVIndirect:
+			c = aov.indirect
+		default:
+			if !aov.hit || ((a == AOVMaterialID || a == AOVObjectID) && k > 0) {
+				continue
+			}
+			c = s.aovValue(a, aov)
+		}
+		tiles[a].AddSample(x, y, c, 1)
+	}
+}
+
+// aovValue returns the value of a surface AOV of a camera ray that hit.
+func (s *Scene) aovValue(a AOV, aov *AOVRecord) textures.Color {
+	switch a {
+	case AOVDepth:
+		return textures.NewColor(aov.depth, aov.depth, aov.depth)
+	case AOVNormal:
+		return textures.NewColor(aov.normal.X(), aov.normal.Y(), aov.normal.Z())
+	case AOVAlbedo:
+		return aov.albedo
+	case AOVMaterialID:
+		id := float64(s.materialIDs[aov.material])
+		return textures.NewColor(id, id, id)
+	}
+	id := float64(aov.object)
+	return textures.NewColor(id, id, id)
+}
+
+// SaveAOVs saves the AOVs of the last render next to the image saved at path.
+// OpenEXR images already hold them as layers, other formats get an image per
+// AOV named after the image and the AOV. PNG images show depth relative to
+// the farthest hit, normals mapped to [0, 1] and IDs as random colors.
+func (s *Scene) SaveAOVs(path string) error {
+	ext := filepath.Ext(path)
+	if strings.ToLower(ext) == ".exr" {
+		return nil
+	}
+	base := strings.TrimSuffix(path, ext)
+	for _, a := range s.outputAOVs {
+		film := s.AOV(a)
+		if strings.ToLower(ext) != ".pfm" {
+			film = visualizeAOV(a, film)
+		}
+		if err := film.Save(base + "_" + a.String() + ext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visualizeAOV returns a film that shows the data of an AOV as colors.
+func visualizeAOV(a AOV, film *Film) *Film {
+	if a != AOVDepth && a != AOVNormal && a != AOVMaterialID && a != AOVObjectID {
+		return film
+	}
+	out := NewFilm(film.Width(), film.Height())
+	out.SetToneMapping(postprocess.Data())
+	far := 0.0
+	for j := 0; j < film.Height(); j++ {
+		for i := 0; i < film.Width(); i++ {
+			far = math.Max(far, film.Pixel(i, j).Color.R)
+		}
+	}
+	for j := 0; j < film.Height(); j++ {
+		for i := 0; i < film.Width(); i++ {
+			p := film.Pixel(i, j)
+			if p.Weight == 0 {
+				continue
+			}
+			c := p.Color
+			switch a {
+			case AOVDepth:
+				c = c.DivideScalar(math.Max(far, 1e-9))
+			case AOVNormal:
+				c = c.AddScalar(1).MultiplyScalar(0.5)
+			default:
+				h := sampling.Hash(uint64(c.R))
+				c = textures.NewColor(float64(h&0xff)/255, float64(h>>8&0xff)/255,
+					float64(h>>16&0xff)/255)
+			}
+			out.Set(i, j, c, 1, p.Weight)
+		}
+	}
+	return out
+}
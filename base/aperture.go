@@ -0,0 +1,131 @@
+package base
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"sort"
+)
+
+// Aperture is the shape of the opening of a lens, which is the shape out of
+// focus highlights take. Sample maps a uniform sample in [0, 1)² to a point
+// of the opening, distributed by how much light passes there, within
+// [-1, 1]² with the unit disk as the fully open lens.
+type Aperture interface {
+	Sample(u1, u2 float64) (x, y float64)
+}
+
+// PolygonAperture is the regular polygon formed by the blades of an iris
+// diaphragm, with its corners on the unit circle.
+type PolygonAperture struct {
+	blades   int
+	rotation float64
+}
+
+// NewPolygonAperture returns the aperture of an iris with the given number of
+// blades, at least 3, rotated by rotation degrees counterclockwise from a
+// corner pointing right.
+func NewPolygonAperture(blades int, rotation float64) *PolygonAperture {
+	if blades < 3 {
+		blades = 3
+	}
+	return &PolygonAperture{blades, rotation * math.Pi / 180}
+}
+
+// Sample picks one of the triangles between the center and two neighbouring
+// corners, which all have the same area, and a uniform point inside it.
+func (a *PolygonAperture) Sample(u1, u2 float64) (float64, float64) {
+	n := float64(a.blades)
+	k := math.Min(math.Floor(u1*n), n-1)
+	u1 = u1*n - k
+	theta0 := a.rotation + 2*math.Pi*k/n
+	theta1 := theta0 + 2*math.Pi/n
+	r := math.Sqrt(u1)
+	x := (1-u2)*math.Cos(theta0) + u2*math.Cos(theta1)
+	y := (1-u2)*math.Sin(theta0) + u2*math.Sin(theta1)
+	return r * x, r * y
+}
+
+// MaskAperture is an aperture shaped like an image, such as a star or a heart
+// cut out of a card in front of the lens. The brighter a pixel of the mask
+// the more light passes through it.
+type MaskAperture struct {
+	width, height int
+	// rows is the cumulative distribution of the rows, columns that of the
+	// pixels within each row.
+	rows, columns []float64
+}
+
+// NewMaskAperture returns the aperture of the mask img, scaled so its longer
+// side spans [-1, 1].
+func NewMaskAperture(img image.Image) (*MaskAperture, error) {
+	b := img.Bounds()
+	a := &MaskAperture{width: b.Dx(), height: b.Dy(), rows: make([]float64, b.Dy()),
+		columns: make([]float64, b.Dx()*b.Dy())}
+	total := 0.0
+	for y := 0; y < a.height; y++ {
+		row := a.columns[y*a.width : (y+1)*a.width]
+		sum := 0.0
+		for x := range row {
+			c := color.NRGBA64Model.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA64)
+			sum += (0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)) *
+				float64(c.A) / (0xffff * 0xffff)
+			row[x] = sum
+		}
+		total += sum
+		a.rows[y] = total
+	}
+	if total == 0 {
+		return nil, errors.New("aperture mask is black")
+	}
+	return a, nil
+}
+
+// LoadMaskAperture returns the aperture of the mask in the image file at path.
+func LoadMaskAperture(path string) (*MaskAperture, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	img, _, err := image.Decode(fp)
+	if err != nil {
+		return nil, err
+	}
+	return NewMaskAperture(img)
+}
+
+// Sample picks a row and a pixel within it by their share of the light and a
+// uniform point inside the pixel.
+func (a *MaskAperture) Sample(u1, u2 float64) (float64, float64) {
+	y, fy := sampleCDF(a.rows, u1)
+	x, fx := sampleCDF(a.columns[y*a.width:(y+1)*a.width], u2)
+	size := float64(a.width)
+	if a.height > a.width {
+		size = float64(a.height)
+	}
+	// Rows count down from the top of the mask.
+	return (2*(float64(x)+fx) - float64(a.width)) / size,
+		(float64(a.height) - 2*(float64(y)+fy)) / size
+}
+
+// sampleCDF returns the bin of the cumulative distribution cdf that u falls
+// in and where in the bin it falls, from 0 to 1.
+func sampleCDF(cdf []float64, u float64) (int, float64) {
+	total := cdf[len(cdf)-1]
+	target := u * total
+	i := sort.Search(len(cdf), func(i int) bool { return cdf[i] > target })
+	if i == len(cdf) {
+		i = len(cdf) - 1
+	}
+	start := 0.0
+	if i > 0 {
+		start = cdf[i-1]
+	}
+	if cdf[i] == start {
+		return i, 0.5
+	}
+	return i, (target - start) / (cdf[i] - start)
+}
@@ -0,0 +1,92 @@
+package base
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"testing"
+)
+
+func TestPolygonAperture(t *testing.T) {
+	a := NewPolygonAperture(6, 30)
+	sampler := sampling.NewIndependent(1)
+	sampler.StartSample(0, 0, 0)
+	// The inscribed circle of a hexagon has a radius of cos(30°).
+	inner, apothem := 0, math.Cos(math.Pi/6)
+	for i := 0; i < 10000; i++ {
+		x, y := a.Sample(sampler.Get2D())
+		r := math.Hypot(x, y)
+		if r > 1+1e-9 {
+			t.Fatalf("sample (%v, %v) is outside the aperture", x, y)
+		}
+		// With corners at 30° plus multiples of 60° the edges cross the x
+		// axis at the apothem.
+		if math.Abs(x) > apothem+1e-9 {
+			t.Fatalf("sample (%v, %v) is outside the rotated hexagon", x, y)
+		}
+		if r < apothem {
+			inner++
+		}
+	}
+	// The area of the inscribed circle is 90.7% of that of the hexagon.
+	if f := float64(inner) / 10000; math.Abs(f-0.9069) > 0.02 {
+		t.Errorf("%v of the samples are inside the inscribed circle, want 0.907", f)
+	}
+}
+
+func TestMaskAperture(t *testing.T) {
+	mask := image.NewGray(image.Rect(0, 0, 4, 2))
+	mask.SetGray(3, 0, color.Gray{255})
+	mask.SetGray(0, 1, color.Gray{85})
+	a, err := NewMaskAperture(mask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampler := sampling.NewIndependent(1)
+	sampler.StartSample(0, 0, 0)
+	topRight := 0
+	for i := 0; i < 4000; i++ {
+		x, y := a.Sample(sampler.Get2D())
+		switch {
+		case x >= 0.5 && x <= 1 && y >= 0 && y <= 0.5:
+			topRight++
+		case x >= -1 && x <= -0.5 && y >= -0.5 && y <= 0:
+		default:
+			t.Fatalf("sample (%v, %v) is outside the mask", x, y)
+		}
+	}
+	if f := float64(topRight) / 4000; math.Abs(f-0.75) > 0.03 {
+		t.Errorf("%v of the samples are in the bright pixel, want 0.75", f)
+	}
+	if _, err := NewMaskAperture(image.NewGray(image.Rect(0, 0, 2, 2))); err == nil {
+		t.Error("a black mask lets light through")
+	}
+}
+
+func TestCatsEyeVignetting(t *testing.T) {
+	camera := NewCameraFOV(primitives.NewVec3(0, 0, 0), primitives.NewVec3(0, 0, -1),
+		primitives.UnitY, 60, 1.5, 0.5, 2, 0, 1)
+	camera.ToggleBlur()
+	camera.SetCatsEye(1)
+	sampler := sampling.NewIndependent(1)
+	sampler.StartSample(0, 0, 0)
+	passed := func(u, v float64) int {
+		n := 0
+		for i := 0; i < 2000; i++ {
+			if _, weight := camera.GetWeightedRay(u, v, sampler); weight > 0 {
+				n++
+			}
+		}
+		return n
+	}
+	if center := passed(0.5, 0.5); center != 2000 {
+		t.Errorf("%d of 2000 rays pass the center of the image", center)
+	}
+	// In the corner the barrel is shifted by a whole radius, the lens shaped
+	// overlap of the disks is 39% of the aperture.
+	if corner := float64(passed(0, 1)) / 2000; math.Abs(corner-0.391) > 0.04 {
+		t.Errorf("%v of the rays pass the corner of the image, want 0.39", corner)
+	}
+}
@@ -2,24 +2,59 @@ package base
 
 import (
 	"math"
-	"math/rand"
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"raytracer/utils"
 )
 
+// CameraModel generates the rays a scene is rendered with. (u, v) is the
+// position on the film, both in [0, 1] with v counting up from the bottom of
+// the image. Cameras that see nothing at a position return a nil ray. The
+// time of every ray lies in the shutter interval.
+type CameraModel interface {
+	GetRay(u, v float64, sampler sampling.Sampler) *primitives.Ray
+	Shutter() (t0, t1 float64)
+}
+
+// WeightedCamera is a camera that blocks part of the light of some rays, like
+// a lens that vignettes. GetWeightedRay returns the ray through (u, v) and the
+// fraction of its light that reaches the film. Rays that are blocked entirely
+// have a weight of zero and may be nil, unlike the rays GetRay returns nil
+// for they still count as covering the film.
+type WeightedCamera interface {
+	CameraModel
+	GetWeightedRay(u, v float64, sampler sampling.Sampler) (*primitives.Ray, float64)
+}
+
+// ThinLens is a camera with a thin lens whose blur and shape can be changed.
+type ThinLens interface {
+	ToggleBlur() bool
+	SetAperture(aperture Aperture)
+	SetAnamorphic(squeeze float64)
+	SetCatsEye(amount float64)
+}
+
 // Camera is a the container for the information about the viewer.
 type Camera struct {
 	ll, horizontal, vertical, origin primitives.Vec3
 	u, v, w                          primitives.Vec3
 	lensRadius, t0, t1               float64
 	blur                             bool
+	// orthographic cameras shoot parallel rays along -w from the view
+	// rectangle spanned by horizontal and vertical at ll.
+	orthographic bool
+	// aperture is the shape of the lens, a disk if nil. The lens is squeezed
+	// horizontally by squeeze, and catsEye is how far the barrel of the lens
+	// shifts across the aperture towards the corners of the image.
+	aperture         Aperture
+	squeeze, catsEye float64
 }
 
 // NewCamera returns a new camera object with the specified parameters.
 func NewCamera(ll, horizontal, vertical, origin, u, v, w primitives.Vec3, lensRadius, t0, t1 float64) *Camera {
-	return &Camera{ll, horizontal, vertical, origin,
-		u, v, w,
-		lensRadius, t0, t1, false}
+	return &Camera{ll: ll, horizontal: horizontal, vertical: vertical, origin: origin,
+		u: u, v: v, w: w,
+		lensRadius: lensRadius, t0: t0, t1: t1}
 }
 
 // NewCameraFromCoordinates ...
@@ -57,25 +92,110 @@ func NewCameraFOV(origin, lookat, vup primitives.Vec3, vfov, aspect, aperature,
 	return NewCamera(ll, horizontal, vertical, origin, u, v, w, lensRadius, t0, t1)
 }
 
+// NewCameraOrthographic returns a new camera that looks from origin towards
+// lookat with an orthographic projection, showing a view of width x height
+// units centered on origin.
+func NewCameraOrthographic(origin, lookat, vup primitives.Vec3, width, height, t0, t1 float64) *Camera {
+	w := origin.Subtract(lookat).Normalize()
+	u := vup.Cross(w).Normalize()
+	v := w.Cross(u)
+	ll := origin.
+		Subtract(u.MultiplyScalar(width / 2)).
+		Subtract(v.MultiplyScalar(height / 2))
+	c := NewCamera(ll, u.MultiplyScalar(width), v.MultiplyScalar(height), origin,
+		u, v, w, 0, t0, t1)
+	c.orthographic = true
+	return c
+}
+
 // ToggleBlur turns blur to on if off and vice versa.
 func (c *Camera) ToggleBlur() bool {
 	c.blur = !c.blur
 	return c.blur
 }
 
-// GetRay returns a ray from the point of view of the camera.
-func (c *Camera) GetRay(u, v float64) *primitives.Ray {
-	time := primitives.WithTime(c.t0 + rand.Float64()*(c.t1-c.t0))
+// Shutter returns the interval the camera is open.
+func (c *Camera) Shutter() (float64, float64) {
+	return c.t0, c.t1
+}
+
+// SetAperture sets the shape of the lens that shows in out of focus
+// highlights when blur is on. Nil restores the disk.
+func (c *Camera) SetAperture(aperture Aperture) {
+	c.aperture = aperture
+}
+
+// SetAnamorphic squeezes the lens horizontally like an anamorphic lens, which
+// turns out of focus highlights into ovals squeeze times as high as wide.
+func (c *Camera) SetAnamorphic(squeeze float64) {
+	c.squeeze = squeeze
+}
+
+// SetCatsEye turns on optical vignetting: the barrel of the lens cuts off the
+// aperture off the axis of the lens, which darkens the corners of the image
+// and turns out of focus highlights there into cat's eyes. In the corners
+// the barrel is shifted by amount times the radius of the aperture.
+func (c *Camera) SetCatsEye(amount float64) {
+	c.catsEye = amount
+}
+
+// GetRay returns a ray from the point of view of the camera, or nil if it is
+// vignetted.
+func (c *Camera) GetRay(u, v float64, sampler sampling.Sampler) *primitives.Ray {
+	r, _ := c.GetWeightedRay(u, v, sampler)
+	return r
+}
+
+// GetWeightedRay returns a ray from the point of view of the camera, which
+// is blocked when it misses the barrel of a vignetting lens.
+func (c *Camera) GetWeightedRay(u, v float64, sampler sampling.Sampler) (*primitives.Ray, float64) {
+	time := primitives.WithTime(c.t0 + sampler.Get1D()*(c.t1-c.t0))
+	if c.orthographic {
+		return primitives.NewRay(c.ll.
+			Add(c.horizontal.MultiplyScalar(u)).
+			Add(c.vertical.MultiplyScalar(v)), c.w.MultiplyScalar(-1), time), 1
+	}
 	if c.blur {
-		rd := utils.RandomInUnitDisk().MultiplyScalar(c.lensRadius)
-		offset := c.u.MultiplyScalar(rd.X()).Add(c.v.MultiplyScalar(rd.Y()))
+		x, y, ok := c.lensPoint(u, v, sampler)
+		if !ok {
+			return nil, 0
+		}
+		offset := c.u.MultiplyScalar(x * c.lensRadius).Add(c.v.MultiplyScalar(y * c.lensRadius))
 		return primitives.NewRay(c.origin.Add(offset), c.ll.
 			Add(c.horizontal.MultiplyScalar(u)).
 			Add(c.vertical.MultiplyScalar(v)).
-			Subtract(c.origin).Subtract(offset), time)
+			Subtract(c.origin).Subtract(offset), time), 1
 	}
 	return primitives.NewRay(c.origin, c.ll.
 		Add(c.horizontal.MultiplyScalar(u)).
 		Add(c.vertical.MultiplyScalar(v)).
-		Subtract(c.origin), time)
+		Subtract(c.origin), time), 1
+}
+
+// lensPoint returns the point of the lens, in units of its radius, that the
+// ray through the film position (u, v) passes, or false if the barrel of the
+// lens blocks it.
+func (c *Camera) lensPoint(u, v float64, sampler sampling.Sampler) (float64, float64, bool) {
+	var x, y float64
+	if c.aperture != nil {
+		x, y = c.aperture.Sample(sampler.Get2D())
+	} else {
+		rd := utils.RandomInUnitDisk(sampler)
+		x, y = rd.X(), rd.Y()
+	}
+	if c.catsEye > 0 {
+		// The barrel moves towards the corners in proportion to the distance
+		// from the center of the image.
+		width, height := c.horizontal.Magnitude(), c.vertical.Magnitude()
+		diagonal := math.Hypot(width, height) / 2
+		bx := c.catsEye * (u - 0.5) * width / diagonal
+		by := c.catsEye * (v - 0.5) * height / diagonal
+		if (x-bx)*(x-bx)+(y-by)*(y-by) > 1 {
+			return 0, 0, false
+		}
+	}
+	if c.squeeze > 0 {
+		x /= c.squeeze
+	}
+	return x, y, true
 }
@@ -0,0 +1,137 @@
+package base
+
+import (
+	"math"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"testing"
+)
+
+func TestOrthographicCamera(t *testing.T) {
+	camera := NewCameraOrthographic(primitives.NewVec3(0, 0, 5), primitives.NewVec3(0, 0, 0),
+		primitives.UnitY, 4, 2, 0, 1)
+	sampler := sampling.NewIndependent(1)
+	for _, uv := range [][2]float64{{0, 0}, {0.5, 0.5}, {1, 1}, {0.25, 0.75}} {
+		r := camera.GetRay(uv[0], uv[1], sampler)
+		want := primitives.NewVec3(4*uv[0]-2, 2*uv[1]-1, 5)
+		if r.Origin().Subtract(want).Magnitude() > 1e-9 {
+			t.Errorf("ray at %v starts at %v, want %v", uv, r.Origin(), want)
+		}
+		if d := r.Direction().Normalize(); math.Abs(d.Z()+1) > 1e-9 {
+			t.Errorf("ray at %v points along %v", uv, d)
+		}
+	}
+}
+
+func direction(c CameraModel, u, v float64) primitives.Vec3 {
+	return c.GetRay(u, v, sampling.NewIndependent(1)).Direction().Normalize()
+}
+
+func sameDirection(t *testing.T, name string, got, want primitives.Vec3) {
+	if got.Subtract(want).Magnitude() > 1e-9 {
+		t.Errorf("%s looks along %v, want %v", name, got, want)
+	}
+}
+
+func TestPanoramicCameras(t *testing.T) {
+	origin, lookat := primitives.NewVec3(1, 2, 3), primitives.NewVec3(1, 2, 0)
+	minusZ := primitives.UnitZ.MultiplyScalar(-1)
+
+	equirect := NewEquirectangularCamera(origin, lookat, primitives.UnitY, 0, 1)
+	sameDirection(t, "equirectangular center", direction(equirect, 0.5, 0.5), minusZ)
+	sameDirection(t, "equirectangular edge", direction(equirect, 0, 0.5), primitives.UnitZ)
+	sameDirection(t, "equirectangular quarter", direction(equirect, 0.75, 0.5), primitives.UnitX)
+	sameDirection(t, "equirectangular top", direction(equirect, 0.3, 1), primitives.UnitY)
+
+	cubemap := NewCubemapCamera(origin, lookat, primitives.UnitY, 0, 1)
+	for face, want := range []primitives.Vec3{primitives.UnitX, primitives.UnitX.MultiplyScalar(-1),
+		primitives.UnitY, primitives.UnitY.MultiplyScalar(-1), primitives.UnitZ, minusZ} {
+		sameDirection(t, "cube face center", direction(cubemap, (float64(face)+0.5)/6, 0.5), want)
+	}
+	// The left edge of the -z face meets the right edge of the -x face.
+	sameDirection(t, "cube face edge", direction(cubemap, 5.0/6, 0.3), direction(cubemap, 2.0/6-1e-12, 0.3))
+
+	for _, mapping := range []FisheyeMapping{Equidistant, Equisolid} {
+		fisheye := NewFisheyeCamera(origin, lookat, primitives.UnitY, 180, 2, mapping, 0, 1)
+		sameDirection(t, "fisheye center", direction(fisheye, 0.5, 0.5), minusZ)
+		sameDirection(t, "fisheye rim", direction(fisheye, 0.5, 1), primitives.UnitY)
+		sameDirection(t, "fisheye side", direction(fisheye, 0.75, 0.5), primitives.UnitX)
+		if r := fisheye.GetRay(0.1, 0.5, sampling.NewIndependent(1)); r != nil {
+			t.Errorf("fisheye shot %v outside its image circle", r)
+		}
+	}
+}
+
+func TestStereoCamera(t *testing.T) {
+	center := NewCameraFOV(primitives.NewVec3(0, 0, 0), primitives.NewVec3(0, 0, -1),
+		primitives.UnitY, 60, 1, 0, 2, 0, 1)
+	rig := NewStereoCamera(center, 0.1, 5, SideBySide)
+	sampler := sampling.NewIndependent(1)
+	for _, uv := range [][2]float64{{0.5, 0.5}, {0.1, 0.9}, {0.8, 0.3}} {
+		left := rig.GetRay(uv[0]/2, uv[1], sampler)
+		right := rig.GetRay(0.5+uv[0]/2, uv[1], sampler)
+		if d := left.Origin().Subtract(right.Origin()); math.Abs(d.X()+0.1) > 1e-9 || d.Y() != 0 || d.Z() != 0 {
+			t.Errorf("eyes are %v apart", d)
+		}
+		// The rays of both eyes meet on the plane of convergence.
+		a := left.PointAt(5 / -left.Direction().Z())
+		b := right.PointAt(5 / -right.Direction().Z())
+		if a.Subtract(b).Magnitude() > 1e-9 {
+			t.Errorf("rays through %v meet the plane of convergence at %v and %v", uv, a, b)
+		}
+	}
+
+	tb := NewStereoCamera(center, 0.1, 0, TopBottom)
+	top, bottom := tb.GetRay(0.5, 0.75, sampler), tb.GetRay(0.5, 0.25, sampler)
+	if top.Origin().X() >= bottom.Origin().X() {
+		t.Errorf("the left eye at %v is not in the top half", top.Origin())
+	}
+	sameDirection(t, "parallel eyes", top.Direction().Normalize(), bottom.Direction().Normalize())
+
+	ods := NewODSCamera(primitives.NewVec3(0, 0, 0), primitives.NewVec3(0, 0, -1),
+		primitives.UnitY, 0.1, 0, SideBySide, 0, 1)
+	for _, u := range []float64{0.1, 0.3, 0.6} {
+		left, right := ods.GetRay(u/2, 0.5, sampler), ods.GetRay(0.5+u/2, 0.5, sampler)
+		sameDirection(t, "ods eyes", left.Direction().Normalize(), right.Direction().Normalize())
+		baseline := right.Origin().Subtract(left.Origin())
+		if math.Abs(baseline.Magnitude()-0.1) > 1e-9 || math.Abs(baseline.Dot(left.Direction())) > 1e-9 {
+			t.Errorf("ods eyes at %v are %v apart", u, baseline)
+		}
+	}
+}
+
+func TestPhysicalCamera(t *testing.T) {
+	p := &PhysicalCamera{FocalLength: 50, SensorWidth: 36, SensorHeight: 24, FStop: 2,
+		ShutterOpen: 0, ShutterClose: 1, ISO: 100}
+	if fov := p.VFOV(1.5); math.Abs(fov-26.9915) > 1e-3 {
+		t.Errorf("vertical fov is %v, want 26.99", fov)
+	}
+	if fov := p.VFOV(3); math.Abs(fov-2*math.Atan(6.0/50)*180/math.Pi) > 1e-9 {
+		t.Errorf("vertical fov of a wide image is %v", fov)
+	}
+	if a := p.Aperture(); math.Abs(a-0.025) > 1e-12 {
+		t.Errorf("aperture is %v m, want 0.025", a)
+	}
+	if ev := p.EV100(); math.Abs(ev-2) > 1e-12 {
+		t.Errorf("EV100 is %v, want 2", ev)
+	}
+	// Focusing closer moves the lens away from the sensor.
+	near := *p
+	near.FocusDistance = 0.5
+	if near.VFOV(1.5) >= p.VFOV(1.5) {
+		t.Errorf("focusing at 0.5m widens the view to %v", near.VFOV(1.5))
+	}
+
+	p.ShutterOpen, p.ShutterClose = 0.25, 0.5
+	c := p.Camera(primitives.NewVec3(0, 0, 0), primitives.NewVec3(0, 0, -3), primitives.UnitY, 1.5)
+	if t0, t1 := c.Shutter(); t0 != 0.25 || t1 != 0.5 {
+		t.Errorf("shutter is open from %v to %v", t0, t1)
+	}
+	sampler := sampling.NewIndependent(1)
+	sampler.StartSample(0, 0, 0)
+	for i := 0; i < 100; i++ {
+		if time := c.GetRay(0.5, 0.5, sampler).Time(); time < 0.25 || time > 0.5 {
+			t.Fatalf("ray at time %v", time)
+		}
+	}
+}
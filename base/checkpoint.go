@@ -0,0 +1,106 @@
+package base
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"raytracer/textures"
+	"time"
+)
+
+// checkpoint is the state of a render that is written to disk so the render
+// can be resumed after the process dies. The random numbers of a sample only
+// depend on the sampler, its seed, the pixel and the sample index, and a
+// pixel's next sample index is its sample count, so the sampler description
+// and the counts are all the generator state that is needed to continue
+// exactly where the render stopped.
+type checkpoint struct {
+	Width, Height int
+	Sampler       string
+	Sum           []textures.Color
+	Count         []int
+	Mean, M2      []float64
+	Film          []Pixel
+	AOVs          [][]Pixel
+}
+
+// saveCheckpoint writes the accumulation buffer and the film to path. The file
+// is replaced atomically so a crash while saving never destroys the previous
+// checkpoint.
+func (s *Scene) saveCheckpoint(path string) error {
+	var buf bytes.Buffer
+	s.mu.Lock()
+	aovs := make([][]Pixel, numAOVs)
+	for _, a := range s.aovs {
+		aovs[a] = s.aovFilms[a].pixels
+	}
+	err := gob.NewEncoder(&buf).Encode(checkpoint{s.accum.width, s.accum.height,
+		s.sampler.String(), s.accum.sum, s.accum.count, s.accum.mean, s.accum.m2,
+		s.film.pixels, aovs})
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".tmp", buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// loadCheckpoint restores the accumulation buffer and the film from path.
+func (s *Scene) loadCheckpoint(path string) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	var c checkpoint
+	if err := gob.NewDecoder(fp).Decode(&c); err != nil {
+		return fmt.Errorf("reading checkpoint %s: %v", path, err)
+	}
+	if c.Width != s.film.Width() || c.Height != s.film.Height() {
+		return fmt.Errorf("checkpoint %s is %dx%d, but the film is %dx%d", path,
+			c.Width, c.Height, s.film.Width(), s.film.Height())
+	}
+	if sampler := s.sampler.String(); c.Sampler != sampler {
+		return fmt.Errorf("checkpoint %s was rendered with sampler %s, not %s", path,
+			c.Sampler, sampler)
+	}
+	for _, a := range s.aovs {
+		if int(a) >= len(c.AOVs) || len(c.AOVs[a]) == 0 {
+			return fmt.Errorf("checkpoint %s does not have the %s aov", path, a)
+		}
+	}
+	s.accum = &Accumulator{c.Width, c.Height, c.Sum, c.Count, c.Mean, c.M2}
+	copy(s.film.pixels, c.Film)
+	for _, a := range s.aovs {
+		copy(s.aovFilms[a].pixels, c.AOVs[a])
+	}
+	return nil
+}
+
+// checkpointEvery saves a checkpoint to path every interval until done is
+// closed. It keeps trying after a failed save and returns the first error.
+func (s *Scene) checkpointEvery(path string, interval time.Duration, done <-chan struct{}) error {
+	var first error
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.saveCheckpoint(path); err != nil && first == nil {
+				first = err
+			}
+		case <-done:
+			return first
+		}
+	}
+}
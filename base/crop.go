@@ -0,0 +1,203 @@
+package base
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"raytracer/postprocess"
+	"raytracer/textures"
+	"strconv"
+	"strings"
+)
+
+// ParseCropWindow returns the crop window "x0,y0,x1,y1" of a width x height
+// image. The corners are pixel coordinates counting from the top left of the
+// image with the second corner excluded. A coordinate with a % suffix is a
+// percentage of the image size instead, rounded up so adjacent windows cover
+// every pixel exactly once.
+func ParseCropWindow(spec string, width, height int) (image.Rectangle, error) {
+	fields := strings.Split(spec, ",")
+	if len(fields) != 4 {
+		return image.Rectangle{}, fmt.Errorf("crop window %q is not x0,y0,x1,y1", spec)
+	}
+	var v [4]int
+	for i, field := range fields {
+		field = strings.TrimSpace(field)
+		if !strings.HasSuffix(field, "%") {
+			var err error
+			if v[i], err = strconv.Atoi(field); err != nil {
+				return image.Rectangle{}, fmt.Errorf("crop window %q: %v", spec, err)
+			}
+			continue
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(field, "%"), 64)
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("crop window %q: %v", spec, err)
+		}
+		size := width
+		if i%2 == 1 {
+			size = height
+		}
+		v[i] = int(math.Ceil(percent * float64(size) / 100))
+	}
+	window := image.Rect(v[0], v[1], v[2], v[3]).
+		Intersect(image.Rect(0, 0, width, height))
+	if window.Empty() {
+		return image.Rectangle{}, fmt.Errorf("crop window %q is empty", spec)
+	}
+	return window, nil
+}
+
+// window returns the crop window in film coordinates, with y counting up from
+// the bottom, or the whole film if there is none.
+func (s *Scene) window() image.Rectangle {
+	if s.cropWindow.Empty() {
+		return s.film.Rect
+	}
+	h := s.film.Height()
+	return image.Rect(s.cropWindow.Min.X, h-s.cropWindow.Max.Y, s.cropWindow.Max.X,
+		h-s.cropWindow.Min.Y)
+}
+
+// tiles returns the tiles that are rendered. Besides the crop window they
+// cover the border around it that the filter spreads samples into the window
+// from, so the pixels of the window come out as in a render of the whole
+// image.
+func (s *Scene) tiles() []image.Rectangle {
+	border := int(math.Max(0, math.Ceil(s.film.filter.Radius()-0.5)))
+	window := s.window().Inset(-border).Intersect(s.film.Rect)
+	tiles := Tiles(window.Dx(), window.Dy(), s.tileSize, s.tileOrder)
+	for i := range tiles {
+		tiles[i] = tiles[i].Add(window.Min)
+	}
+	return tiles
+}
+
+// cropped returns the part of film inside the crop window if the window is
+// saved on its own, or film otherwise.
+func (s *Scene) cropped(film *Film) *Film {
+	if s.cropWindow.Empty() || s.composite != "" {
+		return film
+	}
+	return film.crop(s.window())
+}
+
+// compositeOver returns the image at s.composite with the pixels of the crop
+// window taken from film. High dynamic range images are combined in linear
+// radiance. Other images hold display colors, so the window is tone mapped
+// before it is pasted in and the rest is saved as it was loaded. Pixels of
+// the window a stopped render did not reach keep the existing image. The
+// layers of film are kept, they cover the whole image but only the window is
+// rendered.
+func (s *Scene) compositeOver(film *Film) (*Film, error) {
+	out, err := loadFilm(s.composite)
+	if err != nil {
+		return nil, err
+	}
+	if out.Width() != film.Width() || out.Height() != film.Height() {
+		return nil, fmt.Errorf("%s is %dx%d, the image is %dx%d", s.composite,
+			out.Width(), out.Height(), film.Width(), film.Height())
+	}
+	display := !highDynamicRange(s.composite)
+	window := s.window()
+	for j := window.Min.Y; j < window.Max.Y; j++ {
+		for i := window.Min.X; i < window.Max.X; i++ {
+			p := film.Pixel(i, j)
+			if p.Weight == 0 {
+				continue
+			}
+			if display {
+				p.Color = film.toneMapping.Apply(p.Color)
+			}
+			out.Set(i, j, p.Color, p.Alpha, 1)
+		}
+	}
+	if !display {
+		out.toneMapping = film.toneMapping
+	}
+	out.compression = film.compression
+	out.layers = film.layers
+	return out, nil
+}
+
+// crop returns the pixels of the film and its layers inside r, in film
+// coordinates, as a new film.
+func (s *Film) crop(r image.Rectangle) *Film {
+	out := *s
+	out.width, out.height = r.Dx(), r.Dy()
+	out.Rect = image.Rect(0, 0, r.Dx(), r.Dy())
+	out.pixels = make([]Pixel, r.Dx()*r.Dy())
+	for j := r.Min.Y; j < r.Max.Y; j++ {
+		copy(out.pixels[(j-r.Min.Y)*r.Dx():], s.pixels[j*s.width+r.Min.X:j*s.width+r.Max.X])
+	}
+	out.layers = make([]layer, len(s.layers))
+	for i, l := range s.layers {
+		out.layers[i] = layer{l.name, l.channels, l.film.crop(r)}
+	}
+	return &out
+}
+
+// highDynamicRange reports whether images saved under fileName keep the
+// linear radiance.
+func highDynamicRange(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	return ext == ".exr" || ext == ".pfm"
+}
+
+// loadFilm reads an OpenEXR image, portable float map or any image the image
+// package decodes, such as PNG, into a film. Low dynamic range images are
+// loaded as display colors with a tone mapping that saves them unchanged.
+func loadFilm(path string) (*Film, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pfm":
+		return readPFM(fp)
+	case ".exr":
+		width, height, channels, err := decodeEXR(fp)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range []string{"R", "G", "B"} {
+			if channels[name] == nil {
+				return nil, fmt.Errorf("%s has no %s channel", path, name)
+			}
+		}
+		film := NewFilm(width, height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				k := (height-1-y)*width + x
+				alpha := 1.0
+				if channels["A"] != nil {
+					alpha = float64(channels["A"][k])
+				}
+				film.Set(x, y, textures.NewColor(float64(channels["R"][k]),
+					float64(channels["G"][k]), float64(channels["B"][k])), alpha, 1)
+			}
+		}
+		return film, nil
+	}
+
+	img, _, err := image.Decode(fp)
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	film := NewFilm(b.Dx(), b.Dy())
+	film.SetToneMapping(postprocess.Data())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			c := color.NRGBA64Model.Convert(img.At(b.Min.X+x, b.Max.Y-1-y)).(color.NRGBA64)
+			film.Set(x, y, textures.NewColor(float64(c.R)/0xffff, float64(c.G)/0xffff,
+				float64(c.B)/0xffff), float64(c.A)/0xffff, 1)
+		}
+	}
+	return film, nil
+}
@@ -0,0 +1,50 @@
+package base
+
+import (
+	"math"
+	"raytracer/postprocess"
+	"raytracer/textures"
+)
+
+// guideAOVs are the AOVs the denoiser is steered by.
+var guideAOVs = []AOV{AOVNormal, AOVAlbedo, AOVDepth}
+
+// denoised returns a copy of the film with the noise removed by the scene's
+// denoiser, or the film itself if the scene has none. The copy keeps the
+// weights, alpha, tone mapping and layers of the film.
+func (s *Scene) denoised() *Film {
+	if s.denoiser == nil {
+		return s.film
+	}
+	width, height := s.film.Width(), s.film.Height()
+	n := width * height
+	color := make([]textures.Color, n)
+	guides := postprocess.Guides{Normal: make([]textures.Color, n),
+		Albedo: make([]textures.Color, n), Depth: make([]float64, n),
+		Variance: make([]float64, n)}
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			k := j*width + i
+			color[k] = s.film.Pixel(i, j).Color
+			guides.Normal[k] = s.aovFilms[AOVNormal].Pixel(i, j).Color
+			guides.Albedo[k] = s.aovFilms[AOVAlbedo].Pixel(i, j).Color
+			guides.Depth[k] = s.aovFilms[AOVDepth].Pixel(i, j).Color.R
+			// The variance of the mean shrinks with the number of samples.
+			guides.Variance[k] = math.Inf(1)
+			if count := s.accum.Count(i, j); count >= 2 {
+				guides.Variance[k] = s.accum.Variance(i, j) / float64(count)
+			}
+		}
+	}
+	color = s.denoiser.Denoise(width, height, color, guides)
+
+	film := *s.film
+	film.pixels = make([]Pixel, n)
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			p := s.film.Pixel(i, j)
+			film.Set(i, j, color[j*width+i], p.Alpha, p.Weight)
+		}
+	}
+	return &film
+}
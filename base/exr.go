@@ -0,0 +1,361 @@
+package base
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+)
+
+// EXRCompression is the compression of the pixel data of an OpenEXR file.
+type EXRCompression byte
+
+// The supported OpenEXR compressions, the values are the ones stored in the
+// file.
+const (
+	EXRNone EXRCompression = 0
+	EXRZip  EXRCompression = 3
+)
+
+// exrZips compresses single scanlines like EXRZip. It is only read.
+const exrZips EXRCompression = 2
+
+// The pixel types of OpenEXR channels.
+const (
+	exrUint  = 0
+	exrHalf  = 1
+	exrFloat = 2
+)
+
+// ParseEXRCompression returns the compression with the given name: none or
+// zip.
+func ParseEXRCompression(name string) (EXRCompression, error) {
+	switch strings.ToLower(name) {
+	case "none":
+		return EXRNone, nil
+	case "zip":
+		return EXRZip, nil
+	}
+	return EXRNone, fmt.Errorf("unknown exr compression %q", name)
+}
+
+// exrChannel is a named channel of an OpenEXR image. value returns the
+// channel at (x, y) with y counting down from the top of the image.
+type exrChannel struct {
+	name  string
+	value func(x, y int) float32
+}
+
+// linesPerChunk returns the number of scanlines stored together.
+func (c EXRCompression) linesPerChunk() int {
+	if c == EXRZip {
+		return 16
+	}
+	return 1
+}
+
+// writeEXR writes a single part scanline OpenEXR image with 32-bit float
+// channels to w.
+func writeEXR(w io.Writer, width, height int, channels []exrChannel, compression EXRCompression) error {
+	channels = append([]exrChannel(nil), channels...)
+	// Readers expect the channels sorted by name.
+	sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+
+	var header bytes.Buffer
+	le := func(v interface{}) { binary.Write(&header, binary.LittleEndian, v) }
+	attribute := func(name, kind string, size int) {
+		header.WriteString(name + "\x00" + kind + "\x00")
+		le(int32(size))
+	}
+	le(uint32(20000630))
+	le(uint32(2))
+
+	size := 1
+	for _, c := range channels {
+		size += len(c.name) + 1 + 16
+	}
+	attribute("channels", "chlist", size)
+	for _, c := range channels {
+		header.WriteString(c.name + "\x00")
+		le(int32(2)) // FLOAT
+		le([4]byte{})
+		le([2]int32{1, 1})
+	}
+	header.WriteByte(0)
+	attribute("compression", "compression", 1)
+	header.WriteByte(byte(compression))
+	attribute("dataWindow", "box2i", 16)
+	le([4]int32{0, 0, int32(width - 1), int32(height - 1)})
+	attribute("displayWindow", "box2i", 16)
+	le([4]int32{0, 0, int32(width - 1), int32(height - 1)})
+	attribute("lineOrder", "lineOrder", 1)
+	header.WriteByte(0) // INCREASING_Y
+	attribute("pixelAspectRatio", "float", 4)
+	le(float32(1))
+	attribute("screenWindowCenter", "v2f", 8)
+	le([2]float32{0, 0})
+	attribute("screenWindowWidth", "float", 4)
+	le(float32(1))
+	header.WriteByte(0)
+
+	lines := compression.linesPerChunk()
+	var chunks [][]byte
+	for y := 0; y < height; y += lines {
+		var raw bytes.Buffer
+		for line := y; line < y+lines && line < height; line++ {
+			for _, c := range channels {
+				for x := 0; x < width; x++ {
+					binary.Write(&raw, binary.LittleEndian, math.Float32bits(c.value(x, line)))
+				}
+			}
+		}
+		data := raw.Bytes()
+		if compression == EXRZip {
+			data = zipChunk(data)
+		}
+		chunks = append(chunks, data)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(header.Bytes())
+	// The offset table is followed by the chunks, each with its first scanline
+	// and its size.
+	offset := uint64(header.Len() + 8*len(chunks))
+	for _, chunk := range chunks {
+		binary.Write(bw, binary.LittleEndian, offset)
+		offset += uint64(8 + len(chunk))
+	}
+	for i, chunk := range chunks {
+		binary.Write(bw, binary.LittleEndian, [2]int32{int32(i * lines), int32(len(chunk))})
+		if _, err := bw.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// zipChunk compresses the pixel data of a chunk the way OpenEXR's ZIP
+// compression does. The bytes are split into even and odd positions and delta
+// encoded before deflating. Chunks that do not get smaller are stored as is,
+// which readers detect from the size.
+func zipChunk(raw []byte) []byte {
+	tmp := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+	for i := range raw {
+		if i%2 == 0 {
+			tmp[i/2] = raw[i]
+		} else {
+			tmp[half+i/2] = raw[i]
+		}
+	}
+	for i := len(tmp) - 1; i > 0; i-- {
+		tmp[i] = tmp[i] - tmp[i-1] + 128
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(tmp)
+	zw.Close()
+	if buf.Len() >= len(raw) {
+		return raw
+	}
+	return buf.Bytes()
+}
+
+// unzipChunk undoes zipChunk.
+func unzipChunk(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(tmp); i++ {
+		tmp[i] = tmp[i-1] + tmp[i] - 128
+	}
+	raw := make([]byte, len(tmp))
+	half := (len(tmp) + 1) / 2
+	for i := range raw {
+		if i%2 == 0 {
+			raw[i] = tmp[i/2]
+		} else {
+			raw[i] = tmp[half+i/2]
+		}
+	}
+	return raw, nil
+}
+
+var errCorruptEXR = errors.New("corrupt openexr image")
+
+// decodeEXR reads a single part scanline OpenEXR image that is uncompressed
+// or ZIP compressed from r. It returns the size of the data window and every
+// channel converted to float, row by row with y counting down from the top.
+func decodeEXR(r io.Reader) (int, int, map[string][]float32, error) {
+	br := bufio.NewReader(r)
+	le := binary.LittleEndian
+	var head [2]uint32
+	if err := binary.Read(br, le, &head); err != nil {
+		return 0, 0, nil, err
+	}
+	if head[0] != 20000630 {
+		return 0, 0, nil, errors.New("not an openexr image")
+	}
+	// Only the long names flag is allowed besides the version.
+	if head[1]&^0x400 != 2 {
+		return 0, 0, nil, fmt.Errorf("unsupported openexr version %#x", head[1])
+	}
+
+	type channel struct {
+		name string
+		kind uint32
+	}
+	var channels []channel
+	compression := EXRCompression(255)
+	var window [4]int32
+	for {
+		name, err := br.ReadString(0)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if name == "\x00" {
+			break
+		}
+		if _, err := br.ReadString(0); err != nil {
+			return 0, 0, nil, err
+		}
+		var size int32
+		if err := binary.Read(br, le, &size); err != nil {
+			return 0, 0, nil, err
+		}
+		if size < 0 {
+			return 0, 0, nil, errCorruptEXR
+		}
+		value := make([]byte, size)
+		if _, err := io.ReadFull(br, value); err != nil {
+			return 0, 0, nil, err
+		}
+		switch strings.TrimSuffix(name, "\x00") {
+		case "channels":
+			for v := value; len(v) > 0 && v[0] != 0; {
+				end := bytes.IndexByte(v, 0)
+				if end < 0 || len(v) < end+17 {
+					return 0, 0, nil, errCorruptEXR
+				}
+				channels = append(channels, channel{string(v[:end]), le.Uint32(v[end+1:])})
+				if le.Uint32(v[end+9:]) != 1 || le.Uint32(v[end+13:]) != 1 {
+					return 0, 0, nil, errors.New("subsampled openexr channels are not supported")
+				}
+				v = v[end+17:]
+			}
+		case "compression":
+			if len(value) != 1 {
+				return 0, 0, nil, errCorruptEXR
+			}
+			compression = EXRCompression(value[0])
+		case "dataWindow":
+			if err := binary.Read(bytes.NewReader(value), le, &window); err != nil {
+				return 0, 0, nil, errCorruptEXR
+			}
+		}
+	}
+	if compression != EXRNone && compression != exrZips && compression != EXRZip {
+		return 0, 0, nil, fmt.Errorf("unsupported openexr compression %d", compression)
+	}
+	width, height := int(window[2]-window[0]+1), int(window[3]-window[1]+1)
+	if width <= 0 || height <= 0 {
+		return 0, 0, nil, errCorruptEXR
+	}
+	lineSize := 0
+	out := make(map[string][]float32)
+	for _, c := range channels {
+		if c.kind > exrFloat {
+			return 0, 0, nil, errCorruptEXR
+		}
+		lineSize += width * 4
+		if c.kind == exrHalf {
+			lineSize -= width * 2
+		}
+		out[c.name] = make([]float32, width*height)
+	}
+
+	lines := compression.linesPerChunk()
+	chunks := (height + lines - 1) / lines
+	// The chunks follow the offset table, so it is not needed.
+	if _, err := br.Discard(8 * chunks); err != nil {
+		return 0, 0, nil, err
+	}
+	for i := 0; i < chunks; i++ {
+		var chunk [2]int32
+		if err := binary.Read(br, le, &chunk); err != nil {
+			return 0, 0, nil, err
+		}
+		y := int(chunk[0] - window[1])
+		if y < 0 || y >= height || chunk[1] < 0 {
+			return 0, 0, nil, errCorruptEXR
+		}
+		data := make([]byte, chunk[1])
+		if _, err := io.ReadFull(br, data); err != nil {
+			return 0, 0, nil, err
+		}
+		n := lines
+		if y+n > height {
+			n = height - y
+		}
+		if len(data) < n*lineSize {
+			var err error
+			if data, err = unzipChunk(data); err != nil {
+				return 0, 0, nil, err
+			}
+		}
+		if len(data) != n*lineSize {
+			return 0, 0, nil, errCorruptEXR
+		}
+		for line := y; line < y+n; line++ {
+			for _, c := range channels {
+				values := out[c.name][line*width : (line+1)*width]
+				for x := range values {
+					switch c.kind {
+					case exrUint:
+						values[x] = float32(le.Uint32(data))
+						data = data[4:]
+					case exrHalf:
+						values[x] = halfToFloat(le.Uint16(data))
+						data = data[2:]
+					case exrFloat:
+						values[x] = math.Float32frombits(le.Uint32(data))
+						data = data[4:]
+					}
+				}
+			}
+		}
+	}
+	return width, height, out, nil
+}
+
+// halfToFloat converts a 16-bit float to a 32-bit one.
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exponent := uint32(h>>10) & 0x1f
+	mantissa := uint32(h) & 0x3ff
+	switch {
+	case exponent == 0:
+		// Zero or subnormal.
+		v := float32(mantissa) / (1 << 24)
+		if sign != 0 {
+			v = -v
+		}
+		return v
+	case exponent == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mantissa<<13)
+	}
+	return math.Float32frombits(sign | (exponent+112)<<23 | mantissa<<13)
+}
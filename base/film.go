@@ -4,24 +4,55 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/png"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"raytracer/filters"
+	"raytracer/postprocess"
+	"raytracer/textures"
+	"strings"
 )
 
-// Film is the screen space that our world is rendered on.
+// Film is the screen space that our world is rendered on. It keeps the linear
+// radiance of every pixel together with its alpha and the weight of the
+// samples that were averaged into it, so no dynamic range is lost until the
+// image is saved in a low dynamic range format. Samples are spread over the
+// pixels around them by the reconstruction filter.
 type Film struct {
 	width, height int
 	Rect          image.Rectangle
-	im            [][]color.Color
+	// pixels holds the filter weighted sums of the samples.
+	pixels      []Pixel
+	filter      filters.Filter
+	compression EXRCompression
+	toneMapping *postprocess.ToneMapping
+	// layers are saved as extra channels of OpenEXR files.
+	layers []layer
+}
+
+// layer is a film that is saved as named channels of another film. The
+// channels hold the red, green and blue components of the film in order.
+type layer struct {
+	name     string
+	channels []string
+	film     *Film
+}
+
+// Pixel is the linear color, alpha and sample weight of a pixel of the film.
+type Pixel struct {
+	Color  textures.Color
+	Alpha  float64
+	Weight float64
 }
 
 // NewFilm returns a new scene to be raytraced.
 func NewFilm(width, height int) *Film {
-	im := make([][]color.Color, width)
-	for i := range im {
-		im[i] = make([]color.Color, height)
-	}
-	return &Film{width, height, image.Rect(0, 0, width, height), im}
+	return &Film{width, height, image.Rect(0, 0, width, height),
+		make([]Pixel, width*height), filters.NewBox(0.5), EXRZip,
+		postprocess.NewToneMapping(postprocess.Clip, 0), nil}
 }
 
 // Width returns the number of horizontal pixels in the film.
@@ -34,9 +65,26 @@ func (s *Film) Height() int {
 	return s.height
 }
 
+// SetFilter sets the reconstruction filter that samples are added with.
+func (s *Film) SetFilter(filter filters.Filter) {
+	s.filter = filter
+}
+
+// SetCompression sets the compression of OpenEXR files saved from the film.
+func (s *Film) SetCompression(compression EXRCompression) {
+	s.compression = compression
+}
+
+// SetToneMapping sets how the radiance of the film is turned into the colors
+// of low dynamic range images. High dynamic range formats store the radiance
+// as is.
+func (s *Film) SetToneMapping(toneMapping *postprocess.ToneMapping) {
+	s.toneMapping = toneMapping
+}
+
 // ColorModel returns the Image's color model.
 func (s *Film) ColorModel() color.Model {
-	return color.RGBAModel
+	return color.NRGBAModel
 }
 
 // Bounds returns the domain for which At can return non-zero color.
@@ -45,35 +93,188 @@ func (s *Film) Bounds() image.Rectangle {
 	return s.Rect
 }
 
-// At returns the color of the pixel at (x, y).
+// At returns the tone mapped color of the pixel at (x, y).
 // At(Bounds().Min.X, Bounds().Min.Y) returns the upper-left pixel of the grid.
 // At(Bounds().Max.X-1, Bounds().Max.Y-1) returns the lower-right one.
 func (s *Film) At(x, y int) color.Color {
-	return s.im[x][y]
+	p := s.Pixel(x, s.height-1-y)
+	c := s.toneMapping.Apply(p.Color)
+	return color.NRGBA{toByte(c.R), toByte(c.G), toByte(c.B), toByte(p.Alpha)}
 }
 
-// Set updates the scene with the corresponding RGB values at the given pixel.
-func (s *Film) Set(x, y int, r, g, b byte) {
-	s.im[x][s.height-1-y] = color.RGBA{r, g, b, 255}
+// Image returns the tone mapped film as an 8-bit image that does not change
+// with the film.
+func (s *Film) Image() *image.NRGBA {
+	img := image.NewNRGBA(s.Rect)
+	draw.Draw(img, img.Rect, s, s.Rect.Min, draw.Src)
+	return img
 }
 
-// Save the file the scene to disk with the corresponding filename in png format.
-func (s *Film) Save(filename string) {
-	if _, err := os.Stat("./output"); os.IsNotExist(err) {
-		os.Mkdir("./output", os.ModePerm)
+// Pixel returns the pixel at (x, y), where y counts up from the bottom of the
+// image.
+func (s *Film) Pixel(x, y int) Pixel {
+	p := s.pixels[y*s.width+x]
+	if p.Weight == 0 {
+		return p
 	}
+	return Pixel{p.Color.DivideScalar(p.Weight), p.Alpha / p.Weight, p.Weight}
+}
 
-	fp, err := os.Create("./output/" + filename + ".png")
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+// Set updates the pixel at (x, y), where y counts up from the bottom of the
+// image, with the linear color c that was averaged over samples of the given
+// total weight.
+func (s *Film) Set(x, y int, c textures.Color, alpha, weight float64) {
+	if weight == 0 {
+		s.pixels[y*s.width+x] = Pixel{c, alpha, 0}
+		return
+	}
+	s.pixels[y*s.width+x] = Pixel{c.MultiplyScalar(weight), alpha * weight, weight}
+}
+
+// clear removes all samples from the film.
+func (s *Film) clear() {
+	for i := range s.pixels {
+		s.pixels[i] = Pixel{}
 	}
+}
 
-	defer fp.Close()
+// AddSample adds a sample with radiance c at the film position (x, y), in
+// pixels with y counting up from the bottom of the image, to the pixels
+// around it.
+func (s *Film) AddSample(x, y float64, c textures.Color, alpha float64) {
+	splat(s.pixels, s.Rect, s.filter, x, y, c, alpha)
+}
 
-	err = png.Encode(fp, s)
+// filmTile collects the samples of a tile before they are merged into the
+// film. It also covers the pixels around the tile that the filter reaches.
+type filmTile struct {
+	bounds image.Rectangle
+	pixels []Pixel
+	filter filters.Filter
+}
+
+// newTile returns an empty buffer for the samples of tile.
+func (s *Film) newTile(tile image.Rectangle) *filmTile {
+	border := int(math.Ceil(s.filter.Radius()))
+	bounds := tile.Inset(-border).Intersect(s.Rect)
+	return &filmTile{bounds, make([]Pixel, bounds.Dx()*bounds.Dy()), s.filter}
+}
+
+// AddSample adds a sample at the film position (x, y) to the tile.
+func (t *filmTile) AddSample(x, y float64, c textures.Color, alpha float64) {
+	splat(t.pixels, t.bounds, t.filter, x, y, c, alpha)
+}
+
+// merge adds the samples of the tile to the film.
+func (s *Film) merge(t *filmTile) {
+	for j := t.bounds.Min.Y; j < t.bounds.Max.Y; j++ {
+		for i := t.bounds.Min.X; i < t.bounds.Max.X; i++ {
+			p := t.pixels[(j-t.bounds.Min.Y)*t.bounds.Dx()+i-t.bounds.Min.X]
+			if p.Weight == 0 {
+				continue
+			}
+			q := &s.pixels[j*s.width+i]
+			q.Color = q.Color.Add(p.Color)
+			q.Alpha += p.Alpha
+			q.Weight += p.Weight
+		}
+	}
+}
+
+// splat adds the sample at (x, y) to the pixels within the filter radius that
+// lie inside bounds. pixels holds the pixels of bounds row by row.
+func splat(pixels []Pixel, bounds image.Rectangle, filter filters.Filter, x, y float64, c textures.Color, alpha float64) {
+	// The filter is evaluated at the offset of the sample from each pixel
+	// center.
+	r := filter.Radius()
+	x0 := int(math.Floor(x-0.5-r)) + 1
+	x1 := int(math.Floor(x - 0.5 + r))
+	y0 := int(math.Floor(y-0.5-r)) + 1
+	y1 := int(math.Floor(y - 0.5 + r))
+	for j := y0; j <= y1; j++ {
+		if j < bounds.Min.Y || j >= bounds.Max.Y {
+			continue
+		}
+		for i := x0; i <= x1; i++ {
+			if i < bounds.Min.X || i >= bounds.Max.X {
+				continue
+			}
+			w := filter.Evaluate(x-float64(i)-0.5, y-float64(j)-0.5)
+			if w == 0 {
+				continue
+			}
+			p := &pixels[(j-bounds.Min.Y)*bounds.Dx()+i-bounds.Min.X]
+			p.Color = p.Color.Add(c.MultiplyScalar(w))
+			p.Alpha += alpha * w
+			p.Weight += w
+		}
+	}
+}
+
+// Save the film to disk at path, creating its directory if needed. The
+// extension of the path selects the format: .exr for OpenEXR, .pfm for the
+// portable float map and .png, the default, for 8-bit PNG.
+func (s *Film) Save(path string) error {
+	if filepath.Ext(path) == "" {
+		path += ".png"
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	fp, err := os.Create(path)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return err
+	}
+	if err := s.Encode(fp, filepath.Ext(path)); err != nil {
+		fp.Close()
+		return err
 	}
+	return fp.Close()
+}
+
+// Encode writes the film to w in the format that belongs to the file
+// extension ext.
+func (s *Film) Encode(w io.Writer, ext string) error {
+	switch strings.ToLower(ext) {
+	case ".exr":
+		return writeEXR(w, s.width, s.height, s.channels(), s.compression)
+	case ".pfm":
+		return writePFM(w, s)
+	case ".png", "":
+		return png.Encode(w, s)
+	}
+	return fmt.Errorf("unknown image format %q", ext)
+}
+
+// channels returns the RGBA channels of the film followed by the channels of
+// its layers.
+func (s *Film) channels() []exrChannel {
+	channel := func(f *Film, name string, value func(p Pixel) float64) exrChannel {
+		return exrChannel{name, func(x, y int) float32 {
+			return float32(value(f.Pixel(x, f.height-1-y)))
+		}}
+	}
+	components := []func(p Pixel) float64{
+		func(p Pixel) float64 { return p.Color.R },
+		func(p Pixel) float64 { return p.Color.G },
+		func(p Pixel) float64 { return p.Color.B },
+	}
+	channels := []exrChannel{
+		channel(s, "R", components[0]),
+		channel(s, "G", components[1]),
+		channel(s, "B", components[2]),
+		channel(s, "A", func(p Pixel) float64 { return p.Alpha }),
+	}
+	for _, l := range s.layers {
+		for i, name := range l.channels {
+			channels = append(channels, channel(l.film, l.name+"."+name, components[i]))
+		}
+	}
+	return channels
+}
+
+// toByte converts a value in [0, 1] to a byte.
+func toByte(v float64) byte {
+	return byte(255*math.Max(0, math.Min(1, v)) + 0.5)
 }
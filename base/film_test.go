@@ -0,0 +1,321 @@
+package base
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math"
+	"raytracer/filters"
+	"raytracer/textures"
+	"testing"
+)
+
+func testFilm(compression EXRCompression) *Film {
+	film := NewFilm(7, 19)
+	film.SetCompression(compression)
+	for j := 0; j < film.Height(); j++ {
+		for i := 0; i < film.Width(); i++ {
+			film.Set(i, j, textures.NewColor(float64(i)*1.5, float64(j)*100, 0.25), 1, 4)
+		}
+	}
+	return film
+}
+
+// readEXR decodes the RGB channels of an image written by writeEXR, with y
+// counting down from the top.
+func readEXR(t *testing.T, data []byte, width, height int) map[string][]float32 {
+	r := bytes.NewReader(data)
+	var magic, version uint32
+	binary.Read(r, binary.LittleEndian, &magic)
+	binary.Read(r, binary.LittleEndian, &version)
+	if magic != 20000630 || version != 2 {
+		t.Fatalf("bad magic %d or version %d", magic, version)
+	}
+	br := bufio.NewReader(r)
+	var names []string
+	compression := -1
+	for {
+		name, _ := br.ReadString(0)
+		if name == "\x00" {
+			break
+		}
+		br.ReadString(0)
+		var size int32
+		binary.Read(br, binary.LittleEndian, &size)
+		value := make([]byte, size)
+		br.Read(value)
+		switch name {
+		case "channels\x00":
+			for v := value; v[0] != 0; {
+				end := bytes.IndexByte(v, 0)
+				names = append(names, string(v[:end]))
+				v = v[end+17:]
+			}
+		case "compression\x00":
+			compression = int(value[0])
+		}
+	}
+	lines := EXRCompression(compression).linesPerChunk()
+	chunks := (height + lines - 1) / lines
+	offsets := make([]uint64, chunks)
+	binary.Read(br, binary.LittleEndian, offsets)
+
+	channels := map[string][]float32{}
+	for _, name := range names {
+		channels[name] = make([]float32, width*height)
+	}
+	for _, offset := range offsets {
+		var y, size int32
+		chunk := bytes.NewReader(data[offset:])
+		binary.Read(chunk, binary.LittleEndian, &y)
+		binary.Read(chunk, binary.LittleEndian, &size)
+		n := lines
+		if int(y)+n > height {
+			n = height - int(y)
+		}
+		raw := data[offset+8 : offset+8+uint64(size)]
+		if want := n * width * len(names) * 4; len(raw) < want {
+			zr, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmp, _ := ioutil.ReadAll(zr)
+			for i := 1; i < len(tmp); i++ {
+				tmp[i] = tmp[i-1] + tmp[i] - 128
+			}
+			raw = make([]byte, len(tmp))
+			half := (len(tmp) + 1) / 2
+			for i := range raw {
+				if i%2 == 0 {
+					raw[i] = tmp[i/2]
+				} else {
+					raw[i] = tmp[half+i/2]
+				}
+			}
+		}
+		for line := 0; line < n; line++ {
+			for _, name := range names {
+				for x := 0; x < width; x++ {
+					bits := binary.LittleEndian.Uint32(raw)
+					raw = raw[4:]
+					channels[name][(int(y)+line)*width+x] = math.Float32frombits(bits)
+				}
+			}
+		}
+	}
+	return channels
+}
+
+func TestEXRRoundTrip(t *testing.T) {
+	for _, compression := range []EXRCompression{EXRNone, EXRZip} {
+		film := testFilm(compression)
+		var buf bytes.Buffer
+		if err := film.Encode(&buf, ".exr"); err != nil {
+			t.Fatal(err)
+		}
+		channels := readEXR(t, buf.Bytes(), film.Width(), film.Height())
+		if len(channels) != 4 {
+			t.Fatalf("got channels %v, want A, B, G and R", channels)
+		}
+		for j := 0; j < film.Height(); j++ {
+			for i := 0; i < film.Width(); i++ {
+				p := film.Pixel(i, j)
+				k := (film.Height()-1-j)*film.Width() + i
+				got := fmt.Sprint(channels["R"][k], channels["G"][k], channels["B"][k], channels["A"][k])
+				want := fmt.Sprint(float32(p.Color.R), float32(p.Color.G), float32(p.Color.B), float32(p.Alpha))
+				if got != want {
+					t.Fatalf("compression %d: pixel (%d, %d) is %s, want %s", compression, i, j, got, want)
+				}
+			}
+		}
+	}
+}
+
+// testEXR returns an OpenEXR image with the data window (x0, y0) to
+// (x0+width-1, y0+len(rows)-1) and a single half channel Y, stored one line
+// per chunk, ZIPS compressed if zips is set.
+func testEXR(x0, y0 int32, rows [][]uint16, zips bool) []byte {
+	le := binary.LittleEndian
+	var buf bytes.Buffer
+	binary.Write(&buf, le, [2]uint32{20000630, 2})
+	attribute := func(name, kind string, value []byte) {
+		buf.WriteString(name + "\x00" + kind + "\x00")
+		binary.Write(&buf, le, int32(len(value)))
+		buf.Write(value)
+	}
+	var channels bytes.Buffer
+	channels.WriteString("Y\x00")
+	binary.Write(&channels, le, [4]int32{exrHalf, 0, 1, 1})
+	channels.WriteByte(0)
+	attribute("channels", "chlist", channels.Bytes())
+	compression := byte(EXRNone)
+	if zips {
+		compression = byte(exrZips)
+	}
+	attribute("compression", "compression", []byte{compression})
+	var window bytes.Buffer
+	binary.Write(&window, le, [4]int32{x0, y0, x0 + int32(len(rows[0])) - 1, y0 + int32(len(rows)) - 1})
+	attribute("dataWindow", "box2i", window.Bytes())
+	buf.WriteByte(0)
+
+	var chunks [][]byte
+	for _, row := range rows {
+		raw := make([]byte, 2*len(row))
+		for x, h := range row {
+			le.PutUint16(raw[2*x:], h)
+		}
+		if zips {
+			// Split the even and the odd bytes, store the differences
+			// between neighbours and deflate them.
+			split := make([]byte, 0, len(raw))
+			for i := 0; i < len(raw); i += 2 {
+				split = append(split, raw[i])
+			}
+			for i := 1; i < len(raw); i += 2 {
+				split = append(split, raw[i])
+			}
+			for i := len(split) - 1; i > 0; i-- {
+				split[i] = split[i] - split[i-1] + 128
+			}
+			var z bytes.Buffer
+			w := zlib.NewWriter(&z)
+			w.Write(split)
+			w.Close()
+			raw = z.Bytes()
+		}
+		chunks = append(chunks, raw)
+	}
+	offset := uint64(buf.Len() + 8*len(chunks))
+	for _, chunk := range chunks {
+		binary.Write(&buf, le, offset)
+		offset += uint64(8 + len(chunk))
+	}
+	for y, chunk := range chunks {
+		binary.Write(&buf, le, [2]int32{y0 + int32(y), int32(len(chunk))})
+		buf.Write(chunk)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeEXR(t *testing.T) {
+	halves := []uint16{0x0000, 0x3c00, 0xc000, 0x3800}
+	rows := make([][]uint16, 3)
+	for y := range rows {
+		rows[y] = make([]uint16, 64)
+		for x := range rows[y] {
+			rows[y][x] = halves[(x/8+y)%len(halves)]
+		}
+	}
+	for _, zips := range []bool{false, true} {
+		width, height, channels, err := decodeEXR(bytes.NewReader(testEXR(-5, 10, rows, zips)))
+		if err != nil {
+			t.Fatalf("zips %v: %v", zips, err)
+		}
+		if width != 64 || height != 3 || len(channels) != 1 {
+			t.Fatalf("zips %v: decoded a %dx%d image with %d channels, want 64x3 with Y", zips, width, height, len(channels))
+		}
+		for y, row := range rows {
+			for x, h := range row {
+				if got, want := channels["Y"][y*width+x], halfToFloat(h); got != want {
+					t.Fatalf("zips %v: pixel (%d, %d) is %v, want %v", zips, x, y, got, want)
+				}
+			}
+		}
+	}
+	if _, _, _, err := decodeEXR(bytes.NewReader([]byte("not an exr image"))); err == nil {
+		t.Error("decoded garbage")
+	}
+}
+
+func TestPFM(t *testing.T) {
+	film := testFilm(EXRNone)
+	var buf bytes.Buffer
+	if err := film.Encode(&buf, ".pfm"); err != nil {
+		t.Fatal(err)
+	}
+	header := "PF\n7 19\n-1.0\n"
+	if !bytes.HasPrefix(buf.Bytes(), []byte(header)) {
+		t.Fatalf("bad header %q", buf.Bytes()[:len(header)])
+	}
+	if want := len(header) + 7*19*12; buf.Len() != want {
+		t.Fatalf("wrote %d bytes, want %d", buf.Len(), want)
+	}
+	// The second pixel of the bottom row.
+	bits := binary.LittleEndian.Uint32(buf.Bytes()[len(header)+12:])
+	if got := math.Float32frombits(bits); got != 1.5 {
+		t.Errorf("red of pixel (1, 0) is %v, want 1.5", got)
+	}
+	read, err := readPFM(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j := 0; j < film.Height(); j++ {
+		for i := 0; i < film.Width(); i++ {
+			if got, want := read.Pixel(i, j).Color, film.Pixel(i, j).Color; got != want {
+				t.Fatalf("pixel (%d, %d) reads back as %v, want %v", i, j, got, want)
+			}
+		}
+	}
+}
+
+func TestHalfToFloat(t *testing.T) {
+	for h, want := range map[uint16]float32{0x0000: 0, 0x3c00: 1, 0xc000: -2,
+		0x3555: 0.333251953125, 0x0001: 1.0 / (1 << 24), 0x7bff: 65504} {
+		if got := halfToFloat(h); got != want {
+			t.Errorf("halfToFloat(%#x) = %v, want %v", h, got, want)
+		}
+	}
+	if got := halfToFloat(0x7c00); !math.IsInf(float64(got), 1) {
+		t.Errorf("halfToFloat(0x7c00) = %v, want +Inf", got)
+	}
+}
+
+func TestFiltersKeepConstantImages(t *testing.T) {
+	c := textures.NewColor(0.25, 2, 8)
+	for _, name := range []string{"box", "tent", "gaussian", "mitchell", "lanczos"} {
+		filter, _ := filters.Parse(name, 0)
+		direct, tiled := NewFilm(9, 7), NewFilm(9, 7)
+		direct.SetFilter(filter)
+		tiled.SetFilter(filter)
+		for _, tile := range Tiles(9, 7, 4, HilbertOrder) {
+			buffer := tiled.newTile(tile)
+			for j := tile.Min.Y; j < tile.Max.Y; j++ {
+				for i := tile.Min.X; i < tile.Max.X; i++ {
+					for k := 0; k < 16; k++ {
+						x := float64(i) + (float64(k%4)+0.5)/4
+						y := float64(j) + (float64(k/4)+0.5)/4
+						direct.AddSample(x, y, c, 1)
+						buffer.AddSample(x, y, c, 1)
+					}
+				}
+			}
+			tiled.merge(buffer)
+		}
+		for j := 0; j < 7; j++ {
+			for i := 0; i < 9; i++ {
+				p, q := direct.Pixel(i, j), tiled.Pixel(i, j)
+				if math.Abs(p.Color.B-c.B) > 1e-9 || math.Abs(p.Alpha-1) > 1e-9 {
+					t.Fatalf("%s: pixel (%d, %d) is %v, want %v", name, i, j, p, c)
+				}
+				if math.Abs(p.Weight-q.Weight) > 1e-9 || math.Abs(p.Color.G-q.Color.G) > 1e-9 {
+					t.Fatalf("%s: tiled pixel (%d, %d) is %v, want %v", name, i, j, q, p)
+				}
+			}
+		}
+	}
+}
+
+func TestTileCoversFilter(t *testing.T) {
+	film := NewFilm(20, 20)
+	film.SetFilter(filters.NewLanczos(3))
+	if got, want := film.newTile(image.Rect(8, 8, 12, 12)).bounds, image.Rect(5, 5, 15, 15); got != want {
+		t.Errorf("tile bounds are %v, want %v", got, want)
+	}
+	if got, want := film.newTile(image.Rect(0, 16, 4, 20)).bounds, image.Rect(0, 13, 7, 20); got != want {
+		t.Errorf("tile bounds are %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+package base
+
+import (
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"raytracer/textures"
+)
+
+// Integrator computes the radiance arriving at the camera along a ray. Scene
+// delegates all light transport to its integrator so new algorithms can be
+// added without touching Render. All random decisions must be drawn from
+// sampler to keep renders reproducible. The first hit and the split into
+// direct and indirect light are recorded in aov, the rays traced in counts.
+type Integrator interface {
+	Li(r *primitives.Ray, s *Scene, sampler sampling.Sampler, aov *AOVRecord, counts *RayCounts) textures.Color
+}
+
+// Background returns the radiance seen by rays that escape the scene.
+type Background func(r *primitives.Ray) textures.Color
+
+// BlackBackground is used by scenes that are only lit by their lights.
+func BlackBackground(r *primitives.Ray) textures.Color {
+	return textures.Black
+}
+
+// SkyBackground is a blue + white gradient used to simulate light coming from
+// the sky.
+func SkyBackground(r *primitives.Ray) textures.Color {
+	unitDirection := r.Direction().Normalize()
+	t := 0.5 * (unitDirection.Y() + 1.0)
+	return textures.Gradient(t)
+}
@@ -0,0 +1,428 @@
+package base
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"strconv"
+	"strings"
+)
+
+// LensElement is one surface of a lens prescription. Lengths are in
+// millimeters.
+type LensElement struct {
+	// CurvatureRadius of the surface, positive if its center lies towards the
+	// film. Zero marks the aperture stop, which is flat.
+	CurvatureRadius float64
+	// Thickness is the distance along the axis to the next surface, or to the
+	// film for the last one.
+	Thickness float64
+	// IOR is the index of refraction behind the surface, 0 for air.
+	IOR float64
+	// ApertureDiameter is the diameter of the surface.
+	ApertureDiameter float64
+}
+
+// ior returns the index of refraction behind the surface.
+func (e LensElement) ior() float64 {
+	if e.IOR == 0 {
+		return 1
+	}
+	return e.IOR
+}
+
+// Lens is a lens prescription, its surfaces ordered from the front of the
+// lens to the film.
+type Lens []LensElement
+
+// ParseLens reads a lens prescription with one surface per line: the radius
+// of curvature, the thickness, the index of refraction and the aperture
+// diameter, in millimeters. Blank lines and lines starting with # are
+// skipped.
+func ParseLens(r io.Reader) (Lens, error) {
+	var lens Lens
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: a lens surface takes 4 numbers, got %d", n, len(fields))
+		}
+		var v [4]float64
+		for i, field := range fields {
+			f, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			v[i] = f
+		}
+		lens = append(lens, LensElement{v[0], v[1], v[2], v[3]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lens) == 0 {
+		return nil, errors.New("lens has no surfaces")
+	}
+	return lens, nil
+}
+
+// LoadLens reads the lens prescription in the file at path.
+func LoadLens(path string) (Lens, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return ParseLens(fp)
+}
+
+// The lens is traced in lens space, in millimeters with the film at z = 0
+// and the lens along -z in front of it.
+
+// front returns the distance from the front of the lens to the film.
+func (l Lens) front() float64 {
+	z := 0.0
+	for _, e := range l {
+		z += e.Thickness
+	}
+	return z
+}
+
+// intersectSurface returns where the ray from o along d meets the spherical
+// surface with the given radius centered on the axis at z, and the normal
+// there facing the ray.
+func intersectSurface(o, d primitives.Vec3, radius, z float64) (float64, primitives.Vec3, bool) {
+	oc := o.Subtract(primitives.NewVec3(0, 0, z))
+	a := d.Dot(d)
+	b := 2 * oc.Dot(d)
+	c := oc.Dot(oc) - radius*radius
+	discriminant := b*b - 4*a*c
+	if discriminant < 0 {
+		return 0, primitives.Vec3{}, false
+	}
+	q := math.Sqrt(discriminant)
+	// Of the two intersections the ray meets the surface on the side facing
+	// it.
+	t := (-b + q) / (2 * a)
+	if (d.Z() > 0) != (radius < 0) {
+		t = (-b - q) / (2 * a)
+	}
+	if t < 0 {
+		return 0, primitives.Vec3{}, false
+	}
+	n := oc.Add(d.MultiplyScalar(t)).Normalize()
+	if n.Dot(d) > 0 {
+		n = n.MultiplyScalar(-1)
+	}
+	return t, n, true
+}
+
+// refract moves the ray from o along d to the surface e at z and refracts it
+// from the index etaI into etaT, or returns false if the surface blocks it.
+func (e LensElement) refract(o, d primitives.Vec3, z, etaI, etaT float64) (primitives.Vec3, primitives.Vec3, bool) {
+	var t float64
+	var n primitives.Vec3
+	if e.CurvatureRadius == 0 {
+		if d.Z() == 0 {
+			return o, d, false
+		}
+		t = (z - o.Z()) / d.Z()
+	} else {
+		var ok bool
+		if t, n, ok = intersectSurface(o, d, e.CurvatureRadius, z+e.CurvatureRadius); !ok {
+			return o, d, false
+		}
+	}
+	p := o.Add(d.MultiplyScalar(t))
+	if p.X()*p.X()+p.Y()*p.Y() > e.ApertureDiameter*e.ApertureDiameter/4 {
+		return o, d, false
+	}
+	if e.CurvatureRadius == 0 {
+		return p, d, true
+	}
+	ok, d := d.Refract(n, etaI/etaT)
+	return p, d, ok
+}
+
+// traceFromFilm returns the ray in lens space that leaves the front of the
+// lens when the ray from o along d enters it from the film, or false if the
+// lens blocks it.
+func (l Lens) traceFromFilm(o, d primitives.Vec3) (primitives.Vec3, primitives.Vec3, bool) {
+	z := 0.0
+	for i := len(l) - 1; i >= 0; i-- {
+		z -= l[i].Thickness
+		etaT := 1.0
+		if i > 0 {
+			etaT = l[i-1].ior()
+		}
+		var ok bool
+		if o, d, ok = l[i].refract(o, d, z, l[i].ior(), etaT); !ok {
+			return o, d, false
+		}
+	}
+	return o, d, true
+}
+
+// traceFromScene returns the ray in lens space that leaves the back of the
+// lens when the ray from o along d enters it from the scene, or false if the
+// lens blocks it.
+func (l Lens) traceFromScene(o, d primitives.Vec3) (primitives.Vec3, primitives.Vec3, bool) {
+	z := -l.front()
+	for i, e := range l {
+		etaI := 1.0
+		if i > 0 {
+			etaI = l[i-1].ior()
+		}
+		var ok bool
+		if o, d, ok = e.refract(o, d, z, etaI, e.ior()); !ok {
+			return o, d, false
+		}
+		z += e.Thickness
+	}
+	return o, d, true
+}
+
+// cardinalPoints returns the z of the principal plane and the focal point of
+// the ray o, d that left the lens after entering it parallel to the axis at
+// the height x.
+func cardinalPoints(x float64, o, d primitives.Vec3) (float64, float64) {
+	tf := -o.X() / d.X()
+	tp := (x - o.X()) / d.X()
+	return o.Z() + tp*d.Z(), o.Z() + tf*d.Z()
+}
+
+// thickLens returns the principal planes and focal points of the thick lens
+// that approximates l, those on the film side first.
+func (l Lens) thickLens() (pz, fz [2]float64, err error) {
+	x := 0.001 * l[0].ApertureDiameter
+	o, d, ok := l.traceFromScene(primitives.NewVec3(x, 0, -l.front()-1), primitives.UnitZ)
+	if !ok {
+		return pz, fz, errors.New("lens blocks rays along its axis")
+	}
+	pz[0], fz[0] = cardinalPoints(x, o, d)
+	o, d, ok = l.traceFromFilm(primitives.NewVec3(x, 0, 1), primitives.UnitZ.MultiplyScalar(-1))
+	if !ok {
+		return pz, fz, errors.New("lens blocks rays along its axis")
+	}
+	pz[1], fz[1] = cardinalPoints(x, o, d)
+	return pz, fz, nil
+}
+
+// FocalLength returns the effective focal length of the lens in millimeters.
+func (l Lens) FocalLength() float64 {
+	pz, fz, err := l.thickLens()
+	if err != nil {
+		return 0
+	}
+	return fz[0] - pz[0]
+}
+
+// FStop returns the f-number of the lens, its focal length divided by the
+// diameter of its entrance pupil.
+func (l Lens) FStop() float64 {
+	// The entrance pupil is as wide as the widest beam parallel to the axis
+	// that makes it through the lens.
+	lo, hi := 0.0, l[0].ApertureDiameter/2
+	for i := 0; i < 50; i++ {
+		h := (lo + hi) / 2
+		if _, _, ok := l.traceFromScene(primitives.NewVec3(h, 0, -l.front()-1), primitives.UnitZ); ok {
+			lo = h
+		} else {
+			hi = h
+		}
+	}
+	if lo == 0 {
+		return math.Inf(1)
+	}
+	return l.FocalLength() / (2 * lo)
+}
+
+// focus returns a copy of l with the distance between its last surface and
+// the film set to bring objects distance millimeters in front of the film
+// into focus, or infinity for zero. Focusing closer moves the lens away from
+// the film, which narrows the field of view.
+func (l Lens) focus(distance float64) (Lens, error) {
+	pz, fz, err := l.thickLens()
+	if err != nil {
+		return nil, err
+	}
+	f := fz[0] - pz[0]
+	if f <= 0 {
+		return nil, errors.New("lens does not converge light")
+	}
+	// delta moves the lens away from the film.
+	delta := f + pz[0]
+	if distance > 0 {
+		z := -distance
+		c := (pz[1] - z - pz[0]) * (pz[1] - z - 4*f - pz[0])
+		if c < 0 {
+			return nil, fmt.Errorf("lens cannot focus closer than %.4g mm", 4*f)
+		}
+		delta = 0.5 * (pz[1] - z + pz[0] - math.Sqrt(c))
+	}
+	focused := append(Lens(nil), l...)
+	focused[len(focused)-1].Thickness += delta
+	if focused[len(focused)-1].Thickness <= 0 {
+		return nil, errors.New("lens cannot focus that far")
+	}
+	return focused, nil
+}
+
+// pupilBounds is the rectangle on the plane of the back of the lens that the
+// rays from a ring of the film leave the lens through.
+type pupilBounds struct {
+	x0, y0, x1, y1 float64
+}
+
+func (b pupilBounds) area() float64 {
+	return (b.x1 - b.x0) * (b.y1 - b.y0)
+}
+
+// pupilRings is the number of rings of the film that get their own bounds
+// of the exit pupil, pupilSamples the number of rays per side of the grid
+// that finds them.
+const (
+	pupilRings   = 64
+	pupilSamples = 64
+)
+
+// RealisticCamera traces the rays from the film through the surfaces of a
+// lens, which gives the distortion, the depth of field and the vignetting
+// of the real lens, and the field of view that changes as it focuses.
+// Rays are sampled from the exit pupil, the part of the back of the lens
+// that light from the film reaches the scene through, which shrinks towards
+// the edges of the film.
+type RealisticCamera struct {
+	frame
+	lens                  Lens
+	filmWidth, filmHeight float64
+	millimeter            float64
+	// pupils are the bounds of the exit pupil for rings of the film from the
+	// center to the corners, and area is the area of the exit pupil at the
+	// center weighted by the falloff of its rays, which makes the weight of
+	// the center 1.
+	pupils []pupilBounds
+	area   float64
+}
+
+// NewRealisticCamera returns a camera at origin that looks at lookat through
+// lens, with a film of filmWidth x filmHeight millimeters and objects at
+// focusDistance in focus, or at infinity for zero. A millimeter is
+// millimeter scene units long.
+func NewRealisticCamera(origin, lookat, vup primitives.Vec3, lens Lens, filmWidth, filmHeight, focusDistance, millimeter, t0, t1 float64) (*RealisticCamera, error) {
+	if len(lens) == 0 {
+		return nil, errors.New("lens has no surfaces")
+	}
+	focused, err := lens.focus(focusDistance / millimeter)
+	if err != nil {
+		return nil, err
+	}
+	c := &RealisticCamera{frame: newFrame(origin, lookat, vup, t0, t1), lens: focused,
+		filmWidth: filmWidth, filmHeight: filmHeight, millimeter: millimeter}
+	c.boundPupils()
+	if c.area == 0 {
+		return nil, errors.New("lens blocks the center of the film")
+	}
+	return c, nil
+}
+
+// rear returns the z of the back of the lens and its radius.
+func (c *RealisticCamera) rear() (float64, float64) {
+	last := c.lens[len(c.lens)-1]
+	return -last.Thickness, last.ApertureDiameter / 2
+}
+
+// boundPupils finds the bounds of the exit pupil for every ring of the film
+// along +x by tracing a grid of rays from the ring to the back of the lens.
+func (c *RealisticCamera) boundPupils() {
+	z, radius := c.rear()
+	extent := 1.5 * radius
+	cell := 2 * extent / pupilSamples
+	diagonal := math.Hypot(c.filmWidth, c.filmHeight) / 2
+	c.pupils = make([]pupilBounds, pupilRings)
+	for ring := range c.pupils {
+		b := pupilBounds{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+		passed, transmitted := 0, 0.0
+		for i := 0; i < pupilSamples*pupilSamples; i++ {
+			r := (float64(ring) + (float64(i)+0.5)/(pupilSamples*pupilSamples)) / pupilRings * diagonal
+			x := -extent + (float64(i%pupilSamples)+0.5)*cell
+			y := -extent + (float64(i/pupilSamples)+0.5)*cell
+			film := primitives.NewVec3(r, 0, 0)
+			d := primitives.NewVec3(x, y, z).Subtract(film)
+			if _, _, ok := c.lens.traceFromFilm(film, d); ok {
+				b = pupilBounds{math.Min(b.x0, x), math.Min(b.y0, y), math.Max(b.x1, x), math.Max(b.y1, y)}
+				passed++
+				transmitted += cos4(d)
+			}
+		}
+		if passed == 0 {
+			continue
+		}
+		// The rays sample the centers of the cells of the grid, the pupil
+		// may reach to their edges.
+		c.pupils[ring] = pupilBounds{b.x0 - cell, b.y0 - cell, b.x1 + cell, b.y1 + cell}
+		if ring == 0 {
+			c.area = cell * cell * transmitted
+		}
+	}
+}
+
+// cos4 returns the cosine to the fourth of the angle between d and the axis,
+// the falloff of the light along d.
+func cos4(d primitives.Vec3) float64 {
+	cos := d.Normalize().Z()
+	return cos * cos * cos * cos
+}
+
+// GetRay returns the ray through the film position (u, v), or nil if the
+// lens blocks it.
+func (c *RealisticCamera) GetRay(u, v float64, sampler sampling.Sampler) *primitives.Ray {
+	r, _ := c.GetWeightedRay(u, v, sampler)
+	return r
+}
+
+// GetWeightedRay returns the ray through the film position (u, v) and its
+// weight, which falls off with the cosine to the fourth of its angle to the
+// axis and with the size of the exit pupil, relative to the center of the
+// film.
+func (c *RealisticCamera) GetWeightedRay(u, v float64, sampler sampling.Sampler) (*primitives.Ray, float64) {
+	// The lens turns the image upside down, the film is turned with it.
+	x, y := -(u-0.5)*c.filmWidth, -(v-0.5)*c.filmHeight
+	r := math.Hypot(x, y)
+	ring := int(r / (math.Hypot(c.filmWidth, c.filmHeight) / 2) * pupilRings)
+	if ring >= pupilRings {
+		ring = pupilRings - 1
+	}
+	b := c.pupils[ring]
+	if b.area() == 0 {
+		return nil, 0
+	}
+	// The bounds lie along +x, they are turned towards the film position.
+	s1, s2 := sampler.Get2D()
+	px, py := b.x0+s1*(b.x1-b.x0), b.y0+s2*(b.y1-b.y0)
+	sin, cos := 0.0, 1.0
+	if r > 0 {
+		sin, cos = y/r, x/r
+	}
+	z, _ := c.rear()
+	film := primitives.NewVec3(x, y, 0)
+	d := primitives.NewVec3(cos*px-sin*py, sin*px+cos*py, z).Subtract(film)
+	o, out, ok := c.lens.traceFromFilm(film, d)
+	if !ok {
+		return nil, 0
+	}
+	weight := cos4(d) * b.area() / c.area
+	ray := c.ray(out.X(), out.Y(), out.Z(), sampler)
+	ray.Update(c.origin.Add(c.u.MultiplyScalar(o.X()*c.millimeter)).
+		Add(c.v.MultiplyScalar(o.Y()*c.millimeter)).
+		Add(c.w.MultiplyScalar(o.Z()*c.millimeter)), ray.Direction())
+	return ray, weight
+}
@@ -0,0 +1,113 @@
+package base
+
+import (
+	"math"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"strings"
+	"testing"
+)
+
+const doubleGauss = `# Double Gauss 50mm F/2
+29.475	3.76	1.67	25.2
+84.83	0.12	1	25.2
+19.275	4.025	1.67	23
+40.77	3.275	1.699	23
+12.75	5.705	1	18
+
+0	4.5	0	17.1
+-14.495	1.18	1.603	17
+40.77	6.065	1.658	20
+-20.385	0.19	1	20
+437.065	3.22	1.717	20
+-39.73	0	1	20
+`
+
+func TestParseLens(t *testing.T) {
+	lens, err := ParseLens(strings.NewReader(doubleGauss))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lens) != 11 {
+		t.Fatalf("lens has %d surfaces, want 11", len(lens))
+	}
+	if want := (LensElement{0, 4.5, 0, 17.1}); lens[5] != want {
+		t.Errorf("stop is %v, want %v", lens[5], want)
+	}
+	if f := lens.FocalLength(); math.Abs(f-50) > 2 {
+		t.Errorf("focal length is %v, want about 50", f)
+	}
+	if n := lens.FStop(); math.Abs(n-2) > 0.5 {
+		t.Errorf("f-number is %v, want about 2", n)
+	}
+	for _, bad := range []string{"", "# nothing\n", "1 2 3\n", "1 2 x 4\n"} {
+		if _, err := ParseLens(strings.NewReader(bad)); err == nil {
+			t.Errorf("parsed %q", bad)
+		}
+	}
+}
+
+// meanWeight returns the mean weight of the rays through (u, v) and where
+// the rays that pass the lens cross the plane z = -distance.
+func meanWeight(c *RealisticCamera, u, v, distance float64) (float64, []primitives.Vec3) {
+	sampler := sampling.NewIndependent(1)
+	var sum float64
+	var hits []primitives.Vec3
+	const n = 4000
+	for i := 0; i < n; i++ {
+		sampler.StartSample(0, 0, i)
+		r, weight := c.GetWeightedRay(u, v, sampler)
+		sum += weight
+		if r != nil {
+			hits = append(hits, r.PointAt((-distance-r.Origin().Z())/r.Direction().Z()))
+		}
+	}
+	return sum / n, hits
+}
+
+func TestRealisticCamera(t *testing.T) {
+	lens, err := ParseLens(strings.NewReader(doubleGauss))
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin, lookat := primitives.NewVec3(0, 0, 0), primitives.NewVec3(0, 0, -1)
+	camera, err := NewRealisticCamera(origin, lookat, primitives.UnitY, lens, 36, 24, 2, 0.001, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	center, hits := meanWeight(camera, 0.5, 0.5, 2)
+	if math.Abs(center-1) > 0.05 {
+		t.Errorf("center of the film has a weight of %v, want 1", center)
+	}
+	// The rays from the center of the film meet on the axis at the focus
+	// distance.
+	for _, p := range hits {
+		if math.Hypot(p.X(), p.Y()) > 0.002 {
+			t.Errorf("ray from the center crosses the plane of focus at %v", p)
+			break
+		}
+	}
+	corner, hits := meanWeight(camera, 1, 1, 2)
+	if corner >= 0.7*center {
+		t.Errorf("corner of the film has a weight of %v, center %v", corner, center)
+	}
+	// The image is upright.
+	if len(hits) == 0 || hits[0].X() <= 0 || hits[0].Y() <= 0 {
+		t.Errorf("top right corner looks at %v", hits)
+	}
+
+	// Focusing closer narrows the view.
+	near, err := NewRealisticCamera(origin, lookat, primitives.UnitY, lens, 36, 24, 0.5, 0.001, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, far := meanWeight(camera, 1, 0.5, 100)
+	_, close := meanWeight(near, 1, 0.5, 100)
+	if close[0].X() >= far[0].X() {
+		t.Errorf("view focused near reaches %v, focused far %v", close[0].X(), far[0].X())
+	}
+
+	if _, err := NewRealisticCamera(origin, lookat, primitives.UnitY, lens, 36, 24, 0.1, 0.001, 0, 1); err == nil {
+		t.Error("focused closer than the lens can")
+	}
+}
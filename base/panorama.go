@@ -0,0 +1,151 @@
+package base
+
+import (
+	"fmt"
+	"math"
+	"raytracer/primitives"
+	"raytracer/sampling"
+)
+
+// frame is the position and orientation shared by the panoramic cameras. The
+// camera looks along -w with v up and u to the right.
+type frame struct {
+	origin, u, v, w primitives.Vec3
+	t0, t1          float64
+}
+
+func newFrame(origin, lookat, vup primitives.Vec3, t0, t1 float64) frame {
+	w := origin.Subtract(lookat).Normalize()
+	u := vup.Cross(w).Normalize()
+	return frame{origin, u, w.Cross(u), w, t0, t1}
+}
+
+// Shutter returns the interval the camera is open.
+func (f *frame) Shutter() (float64, float64) {
+	return f.t0, f.t1
+}
+
+// ray returns the ray from the origin along the direction (x, y, z) in the
+// frame of the camera.
+func (f *frame) ray(x, y, z float64, sampler sampling.Sampler) *primitives.Ray {
+	time := primitives.WithTime(f.t0 + sampler.Get1D()*(f.t1-f.t0))
+	direction := f.u.MultiplyScalar(x).Add(f.v.MultiplyScalar(y)).Add(f.w.MultiplyScalar(z))
+	return primitives.NewRay(f.origin, direction, time)
+}
+
+// Equirectangular is a camera that sees in every direction and maps longitude
+// to the width of the image and latitude to its height, so the image should
+// be twice as wide as it is high. The center of the image looks at the look
+// at point.
+type Equirectangular struct {
+	frame
+}
+
+// NewEquirectangularCamera returns a latitude-longitude camera at origin.
+func NewEquirectangularCamera(origin, lookat, vup primitives.Vec3, t0, t1 float64) *Equirectangular {
+	return &Equirectangular{newFrame(origin, lookat, vup, t0, t1)}
+}
+
+// GetRay returns the ray through the film position (u, v).
+func (c *Equirectangular) GetRay(u, v float64, sampler sampling.Sampler) *primitives.Ray {
+	phi := 2 * math.Pi * (u - 0.5)
+	theta := math.Pi * (v - 0.5)
+	return c.ray(math.Cos(theta)*math.Sin(phi), math.Sin(theta),
+		-math.Cos(theta)*math.Cos(phi), sampler)
+}
+
+// Cubemap is a camera that renders the six faces of a cube around it side by
+// side in the order +x, -x, +y, -y, +z, -z, so the image should be six times
+// as wide as it is high. The axes are those of the camera, which looks along
+// -z with y up. Every face shows what a camera with a field of view of 90
+// degrees sees when it turns from -z towards the face, tilting up or down
+// for the y faces.
+type Cubemap struct {
+	frame
+}
+
+// NewCubemapCamera returns a cube map camera at origin.
+func NewCubemapCamera(origin, lookat, vup primitives.Vec3, t0, t1 float64) *Cubemap {
+	return &Cubemap{newFrame(origin, lookat, vup, t0, t1)}
+}
+
+// cubeFaces are the forward, right and up axes of the faces of a cube map.
+var cubeFaces = [6][3]primitives.Vec3{
+	{primitives.UnitX, primitives.UnitZ, primitives.UnitY},
+	{primitives.UnitX.MultiplyScalar(-1), primitives.UnitZ.MultiplyScalar(-1), primitives.UnitY},
+	{primitives.UnitY, primitives.UnitX, primitives.UnitZ},
+	{primitives.UnitY.MultiplyScalar(-1), primitives.UnitX, primitives.UnitZ.MultiplyScalar(-1)},
+	{primitives.UnitZ, primitives.UnitX.MultiplyScalar(-1), primitives.UnitY},
+	{primitives.UnitZ.MultiplyScalar(-1), primitives.UnitX, primitives.UnitY},
+}
+
+// GetRay returns the ray through the film position (u, v).
+func (c *Cubemap) GetRay(u, v float64, sampler sampling.Sampler) *primitives.Ray {
+	face := int(math.Min(math.Floor(u*6), 5))
+	s, t := 2*(u*6-float64(face))-1, 2*v-1
+	axes := cubeFaces[face]
+	d := axes[0].Add(axes[1].MultiplyScalar(s)).Add(axes[2].MultiplyScalar(t))
+	return c.ray(d.X(), d.Y(), d.Z(), sampler)
+}
+
+// FisheyeMapping is how a fisheye lens maps the angle from its axis to the
+// distance from the center of the image.
+type FisheyeMapping int
+
+// Supported fisheye mappings.
+const (
+	// Equidistant fisheyes keep the distance proportional to the angle.
+	Equidistant FisheyeMapping = iota
+	// Equisolid fisheyes keep areas proportional to solid angles.
+	Equisolid
+)
+
+// Fisheye is a camera that sees the directions within half its field of view
+// of its axis inside a circle that fills the height of the image. Pixels
+// outside the circle get no rays.
+type Fisheye struct {
+	frame
+	fov, aspect float64
+	mapping     FisheyeMapping
+}
+
+// NewFisheyeCamera returns a fisheye camera at origin with a field of view of
+// fov degrees, at most 360, for images with the aspect ratio width / height.
+func NewFisheyeCamera(origin, lookat, vup primitives.Vec3, fov, aspect float64, mapping FisheyeMapping, t0, t1 float64) *Fisheye {
+	return &Fisheye{newFrame(origin, lookat, vup, t0, t1),
+		math.Min(fov, 360) * math.Pi / 180, aspect, mapping}
+}
+
+// GetRay returns the ray through the film position (u, v), or nil if it is
+// outside the image circle.
+func (c *Fisheye) GetRay(u, v float64, sampler sampling.Sampler) *primitives.Ray {
+	x, y := (2*u-1)*c.aspect, 2*v-1
+	r := math.Hypot(x, y)
+	if r > 1 {
+		return nil
+	}
+	theta := r * c.fov / 2
+	if c.mapping == Equisolid {
+		theta = 2 * math.Asin(r*math.Sin(c.fov/4))
+	}
+	phi := math.Atan2(y, x)
+	return c.ray(math.Sin(theta)*math.Cos(phi), math.Sin(theta)*math.Sin(phi),
+		-math.Cos(theta), sampler)
+}
+
+// NewPanoramicCamera returns the panoramic camera with the given name:
+// equirectangular, cubemap, fisheye for an equidistant fisheye or equisolid.
+// fov and aspect are only used by fisheyes.
+func NewPanoramicCamera(name string, origin, lookat, vup primitives.Vec3, fov, aspect, t0, t1 float64) (CameraModel, error) {
+	switch name {
+	case "equirectangular":
+		return NewEquirectangularCamera(origin, lookat, vup, t0, t1), nil
+	case "cubemap":
+		return NewCubemapCamera(origin, lookat, vup, t0, t1), nil
+	case "fisheye":
+		return NewFisheyeCamera(origin, lookat, vup, fov, aspect, Equidistant, t0, t1), nil
+	case "equisolid":
+		return NewFisheyeCamera(origin, lookat, vup, fov, aspect, Equisolid, t0, t1), nil
+	}
+	return nil, fmt.Errorf("unknown panoramic camera %q", name)
+}
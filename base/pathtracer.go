@@ -0,0 +1,133 @@
+package base
+
+import (
+	"math"
+	"raytracer/materials"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"raytracer/textures"
+	"raytracer/utils"
+)
+
+// PathTracer is a unidirectional path tracer. At every bounce it gathers
+// direct light from the scene lights with a shadow ray (next-event
+// estimation), then continues the path in the direction sampled by the
+// material while tracking the path throughput. Light found by both strategies
+// is combined with multiple importance sampling using the power heuristic.
+// Paths longer than rrDepth are terminated with Russian roulette.
+type PathTracer struct {
+	maxDepth, rrDepth int
+}
+
+// NewPathTracer returns a path tracer that follows at most maxDepth bounces
+// and starts Russian roulette after rrDepth bounces.
+func NewPathTracer(maxDepth, rrDepth int) *PathTracer {
+	return &PathTracer{maxDepth, rrDepth}
+}
+
+// Li returns the radiance arriving along r.
+func (p *PathTracer) Li(r *primitives.Ray, s *Scene, sampler sampling.Sampler, aov *AOVRecord, counts *RayCounts) textures.Color {
+	radiance := textures.Black
+	throughput := textures.White
+	// The previous bounce, used to weight light that the material sampling
+	// strategy finds by hitting an emitter.
+	var prev materials.HitRecord
+	var srec materials.ScatterRecord
+	for depth := 0; ; depth++ {
+		var rec materials.HitRecord
+		hit := s.World().Hit(r, 0.001, math.MaxFloat64, &rec)
+		counts.AddRay(&rec)
+		if !hit {
+			background := throughput.Multiply(s.Background(r))
+			aov.AddLight(depth, background)
+			return radiance.Add(background)
+		}
+		m := rec.Material()
+		if depth == 0 {
+			aov.UpdateHit(rec.T()*r.Direction().Magnitude(), rec.Normal(), m.Albedo(&rec),
+				m, rec.Object())
+		}
+		emit := m.Emitted(rec.U(), rec.V(), rec.Point())
+		if emit != textures.Black {
+			if depth > 0 && !srec.Specular() {
+				lightPdf := p.lightPDF(prev.Point(), r.Direction().Normalize(), &rec, s)
+				emit = emit.MultiplyScalar(utils.PowerHeuristic(1, srec.PDF(), 1, lightPdf))
+			}
+			emit = throughput.Multiply(emit)
+			aov.AddLight(depth, emit)
+			radiance = radiance.Add(emit)
+		}
+		if depth == 0 {
+			aov.AddLight(depth, m.GetAmbient())
+			radiance = radiance.Add(m.GetAmbient())
+		}
+		if depth >= p.maxDepth {
+			return radiance
+		}
+
+		direct := throughput.Multiply(p.directLight(r, &rec, s, sampler, counts))
+		aov.AddLight(depth+1, direct)
+		radiance = radiance.Add(direct)
+
+		if !m.Sample(r, &rec, &srec, sampler) {
+			return radiance
+		}
+		throughput = throughput.Multiply(srec.Attenuation())
+		if depth >= p.rrDepth {
+			survive := math.Min(0.95, maxComponent(throughput))
+			if sampler.Get1D() >= survive {
+				return radiance
+			}
+			throughput = throughput.DivideScalar(survive)
+		}
+		prev = rec
+		r = srec.Ray()
+	}
+}
+
+// directLight samples every light once from the hit point and weights each
+// sample against the material sampling strategy. The shadow rays are recorded
+// in counts.
+func (p *PathTracer) directLight(r *primitives.Ray, rec *materials.HitRecord, s *Scene, sampler sampling.Sampler, counts *RayCounts) textures.Color {
+	color := textures.Black
+	m := rec.Material()
+	var ls materials.LightSample
+	for _, light := range s.Lights() {
+		if !light.Sample(rec.Point(), &ls, sampler) || ls.PDF() <= 0 {
+			continue
+		}
+		f := m.Eval(r, rec, ls.Direction())
+		if f == textures.Black {
+			continue
+		}
+		var shadowRec materials.HitRecord
+		shadowRay := primitives.NewRay(rec.Point(), ls.Direction(), primitives.WithTime(r.Time()))
+		occluded := s.World().Hit(shadowRay, 0.001, ls.Distance()-0.001, &shadowRec)
+		counts.AddShadowRay(&shadowRec)
+		if occluded {
+			continue
+		}
+		contribution := f.Multiply(ls.Radiance()).DivideScalar(ls.PDF())
+		if !ls.Delta() {
+			bsdfPdf := m.PDF(r, rec, ls.Direction())
+			contribution = contribution.MultiplyScalar(utils.PowerHeuristic(1, ls.PDF(), 1, bsdfPdf))
+		}
+		color = color.Add(contribution)
+	}
+	return color
+}
+
+// lightPDF returns the density with which directLight samples direction from
+// point towards the emitter of rec. Every light is weighted on its own in
+// directLight, so only the lights of the hit object count.
+func (p *PathTracer) lightPDF(point, direction primitives.Vec3, rec *materials.HitRecord, s *Scene) float64 {
+	pdf := 0.0
+	for _, light := range s.objectLights[rec.Object()] {
+		pdf += light.PDF(point, direction)
+	}
+	return pdf
+}
+
+func maxComponent(c textures.Color) float64 {
+	return math.Max(c.R, math.Max(c.G, c.B))
+}
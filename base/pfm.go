@@ -0,0 +1,75 @@
+package base
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"raytracer/textures"
+)
+
+// writePFM writes the color of the film to w as a little endian portable float
+// map. The rows of a PFM file run from the bottom of the image to the top.
+func writePFM(w io.Writer, s *Film) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", s.width, s.height)
+	var buf [12]byte
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			c := s.Pixel(x, y).Color
+			binary.LittleEndian.PutUint32(buf[0:], math.Float32bits(float32(c.R)))
+			binary.LittleEndian.PutUint32(buf[4:], math.Float32bits(float32(c.G)))
+			binary.LittleEndian.PutUint32(buf[8:], math.Float32bits(float32(c.B)))
+			if _, err := bw.Write(buf[:]); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// readPFM reads a color or grayscale portable float map from r into a film.
+func readPFM(r io.Reader) (*Film, error) {
+	br := bufio.NewReader(r)
+	var magic string
+	var width, height int
+	var scale float64
+	if _, err := fmt.Fscan(br, &magic, &width, &height, &scale); err != nil {
+		return nil, err
+	}
+	// A single whitespace character separates the header from the data.
+	if _, err := br.ReadByte(); err != nil {
+		return nil, err
+	}
+	components := 3
+	if magic == "Pf" {
+		components = 1
+	} else if magic != "PF" {
+		return nil, errors.New("not a portable float map")
+	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("corrupt portable float map")
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+
+	film := NewFilm(width, height)
+	buf := make([]byte, 4*components)
+	v := make([]float64, 3)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if _, err := io.ReadFull(br, buf); err != nil {
+				return nil, err
+			}
+			for i := range v {
+				v[i] = float64(math.Float32frombits(order.Uint32(buf[4*(i%components):])))
+			}
+			film.Set(x, y, textures.NewColor(v[0], v[1], v[2]), 1, 1)
+		}
+	}
+	return film, nil
+}
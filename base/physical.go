@@ -0,0 +1,111 @@
+package base
+
+import (
+	"math"
+	"raytracer/primitives"
+)
+
+// PhysicalCamera describes a real camera body and lens, from which the field
+// of view, the aperture, the shutter interval and the exposure of a Camera
+// are derived. Lengths of the camera are in millimeters and times in
+// seconds.
+type PhysicalCamera struct {
+	// FocalLength of the lens and the size of the sensor.
+	FocalLength               float64
+	SensorWidth, SensorHeight float64
+	// FStop is the focal length divided by the diameter of the aperture.
+	FStop float64
+	// ShutterOpen and ShutterClose are the times the shutter opens and closes,
+	// which is the interval rays are spread over for motion blur.
+	ShutterOpen, ShutterClose float64
+	ISO                       float64
+	// FocusDistance is the distance of the plane in focus in scene units.
+	// Zero focuses at infinity, or on the look at point of Camera.
+	FocusDistance float64
+	// UnitsPerMeter is the size of a meter in scene units, zero for 1.
+	UnitsPerMeter float64
+	// Lens is the prescription of the lens Realistic traces, which takes the
+	// place of the focal length and the f-number.
+	Lens Lens
+}
+
+// millimeter returns the size of a millimeter in scene units.
+func (p *PhysicalCamera) millimeter() float64 {
+	if p.UnitsPerMeter == 0 {
+		return 0.001
+	}
+	return p.UnitsPerMeter / 1000
+}
+
+// imageDistance returns the distance in millimeters between the lens and the
+// sensor that brings the focus distance into focus, which is longer than the
+// focal length for near focus.
+func (p *PhysicalCamera) imageDistance() float64 {
+	if p.FocusDistance <= 0 {
+		return p.FocalLength
+	}
+	d := p.FocusDistance / p.millimeter()
+	if d <= p.FocalLength {
+		return p.FocalLength
+	}
+	return p.FocalLength * d / (d - p.FocalLength)
+}
+
+// gate returns the part of the sensor that is seen by an image with the
+// aspect ratio width / height, the largest one that fits on the sensor.
+func (p *PhysicalCamera) gate(aspect float64) (float64, float64) {
+	if aspect >= p.SensorWidth/p.SensorHeight {
+		return p.SensorWidth, p.SensorWidth / aspect
+	}
+	return p.SensorHeight * aspect, p.SensorHeight
+}
+
+// VFOV returns the vertical field of view in degrees of an image with the
+// aspect ratio width / height.
+func (p *PhysicalCamera) VFOV(aspect float64) float64 {
+	_, height := p.gate(aspect)
+	return 2 * math.Atan(height/(2*p.imageDistance())) * 180 / math.Pi
+}
+
+// Aperture returns the diameter of the aperture in scene units.
+func (p *PhysicalCamera) Aperture() float64 {
+	return p.FocalLength / p.FStop * p.millimeter()
+}
+
+// EV100 returns the exposure value of the settings at ISO 100.
+func (p *PhysicalCamera) EV100() float64 {
+	return math.Log2(p.FStop * p.FStop / (p.ShutterClose - p.ShutterOpen) * 100 / p.ISO)
+}
+
+// Exposure returns the exposure in stops that maps the radiance, in
+// candela per square meter, that saturates the sensor to 1. It follows the
+// saturation based sensitivity of ISO 12232.
+// [Lagarde and de Rousiers, Moving Frostbite to Physically Based Rendering]
+func (p *PhysicalCamera) Exposure() float64 {
+	return -p.EV100() - math.Log2(1.2)
+}
+
+// Camera returns a camera at origin that looks at lookat with the settings
+// of p for an image with the aspect ratio width / height. Depth of field
+// shows once blur is toggled on.
+func (p *PhysicalCamera) Camera(origin, lookat, vup primitives.Vec3, aspect float64) *Camera {
+	focused := *p
+	if focused.FocusDistance <= 0 {
+		focused.FocusDistance = lookat.Subtract(origin).Magnitude()
+	}
+	return NewCameraFOV(origin, lookat, vup, focused.VFOV(aspect), aspect, p.Aperture(),
+		focused.FocusDistance, p.ShutterOpen, p.ShutterClose)
+}
+
+// Realistic returns a camera at origin that looks at lookat through the lens
+// of p, with the part of the sensor an image with the aspect ratio
+// width / height sees as its film.
+func (p *PhysicalCamera) Realistic(origin, lookat, vup primitives.Vec3, aspect float64) (*RealisticCamera, error) {
+	focus := p.FocusDistance
+	if focus <= 0 {
+		focus = lookat.Subtract(origin).Magnitude()
+	}
+	width, height := p.gate(aspect)
+	return NewRealisticCamera(origin, lookat, vup, p.Lens, width, height, focus, p.millimeter(),
+		p.ShutterOpen, p.ShutterClose)
+}
@@ -1,133 +1,598 @@
 package base
 
 import (
-	"math"
-	"math/rand"
+	"context"
+	"image"
+	"os"
 	"raytracer/materials"
 	"raytracer/objects"
+	"raytracer/postprocess"
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"raytracer/textures"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Scene ...
 type Scene struct {
-	camera    *Camera
-	film      *Film
-	world     objects.Object
-	lights    []materials.Light
-	ns, depth int
-}
-
-// NewScene ...
-func NewScene(camera *Camera, film *Film, world objects.Object, lights []materials.Light, ns, depth int) *Scene {
-	return &Scene{camera, film, world, lights, ns, depth}
-}
-
-// TODO add func options to have a variety of backgrounds.
-func (s *Scene) shade(r *primitives.Ray, obj objects.Object, depth int) textures.Color {
-	var rec materials.HitRecord
-	if obj.Hit(r, 0.001, math.MaxFloat64, &rec) {
-		m := rec.Material()
-		emit := m.Emitted(rec.U(), rec.V(), rec.Point())
-		if depth < s.depth {
-			var attenuation textures.Color
-			finalColor := textures.Black
-			if depth == 0 {
-				finalColor = finalColor.Add(m.GetAmbient())
+	camera     CameraModel
+	film       *Film
+	world      objects.Object
+	lights     []materials.Light
+	background Background
+	integrator Integrator
+	sampler    sampling.Sampler
+	ns         int
+	tileSize   int
+	tileOrder  TileOrder
+	accum      *Accumulator
+
+	// objectLights are the area lights of each object of the world, keyed by
+	// the index hits report.
+	objectLights map[int][]materials.Light
+
+	progressive      bool
+	snapshotPasses   int
+	snapshotInterval time.Duration
+	snapshot         func(*Film) error
+
+	adaptive               bool
+	minSamples, maxSamples int
+	threshold              float64
+
+	// aovs are rendered, outputAOVs are also saved.
+	aovs        []AOV
+	outputAOVs  []AOV
+	aovFilms    [numAOVs]*Film
+	materialIDs map[materials.Material]int
+	denoiser    *postprocess.Denoiser
+
+	// cropWindow is in image coordinates, with y counting down from the top.
+	cropWindow image.Rectangle
+	composite  string
+
+	checkpoint         string
+	checkpointInterval time.Duration
+	resume             bool
+
+	bvh      bool
+	stats    Stats
+	progress func(Progress)
+	// done counts the samples taken so far, total the samples of the render.
+	done, total, resumed int64
+	start                time.Time
+	// mu guards the accumulation buffer while a checkpoint is taken.
+	mu sync.Mutex
+}
+
+// NewScene returns a scene rendered with a path tracer that follows at most
+// depth bounces. Emissive shapes in the world that can be sampled are added to
+// the lights. The background and integrator can be changed with the optional
+// parameters.
+func NewScene(camera CameraModel, film *Film, world objects.Object, lights []materials.Light, ns, depth int, options ...func(*Scene)) *Scene {
+	allLights := make([]materials.Light, len(lights))
+	copy(allLights, lights)
+	allLights = append(allLights, objects.CollectLights(world)...)
+	s := &Scene{camera: camera, film: film, world: world, lights: allLights,
+		background: BlackBackground, integrator: NewPathTracer(depth, 3),
+		sampler: sampling.NewIndependent(0), ns: ns,
+		tileSize: 16, tileOrder: HilbertOrder,
+		objectLights: objects.LightsByObject(world)}
+	for _, f := range options {
+		f(s)
+	}
+	s.aovs = append([]AOV(nil), s.outputAOVs...)
+	if s.denoiser != nil {
+		for _, a := range guideAOVs {
+			if !containsAOV(s.aovs, a) {
+				s.aovs = append(s.aovs, a)
 			}
-			for _, light := range s.lights {
-				var shadowRec materials.HitRecord
-				direction := light.Direction(rec.Point())
-				shadowRay := primitives.NewRay(rec.Point(), direction)
-				shadow := obj.Hit(shadowRay, 0.001, math.MaxFloat64, &shadowRec)
-				if shadow {
-					continue
-				}
-				m.Scatter(r, &attenuation, &rec, depth, light, shadow)
-				finalColor = finalColor.Add(attenuation)
+		}
+	}
+	s.cropWindow = s.cropWindow.Intersect(film.Rect)
+	if containsAOV(s.aovs, AOVMaterialID) {
+		s.materialIDs = make(map[materials.Material]int)
+		for i, m := range objects.CollectMaterials(world) {
+			s.materialIDs[m] = i + 1
+		}
+	}
+	if s.bvh {
+		start := time.Now()
+		t0, t1 := camera.Shutter()
+		s.world = objects.NewBVH(world, t0, t1)
+		s.stats.BuildTime = time.Since(start)
+	}
+	return s
+}
+
+// WithBackground is an optional parameter that sets the radiance of rays that
+// escape the scene.
+func WithBackground(background Background) func(*Scene) {
+	return func(s *Scene) {
+		s.background = background
+	}
+}
+
+// WithIntegrator is an optional parameter that replaces the default path
+// tracer.
+func WithIntegrator(integrator Integrator) func(*Scene) {
+	return func(s *Scene) {
+		s.integrator = integrator
+	}
+}
+
+// WithSeed is an optional parameter that seeds the random numbers of every
+// sample. Renders with the same seed produce the same image.
+func WithSeed(seed int64) func(*Scene) {
+	return WithSampler(sampling.NewIndependent(seed))
+}
+
+// WithSampler is an optional parameter that sets the sampler that supplies
+// the pixel, lens, time and scattering samples. Every worker renders with its
+// own clone of it.
+func WithSampler(sampler sampling.Sampler) func(*Scene) {
+	return func(s *Scene) {
+		s.sampler = sampler
+	}
+}
+
+// WithTiles is an optional parameter that sets the size of the square tiles
+// the image is split into and the order they are rendered in.
+func WithTiles(size int, order TileOrder) func(*Scene) {
+	return func(s *Scene) {
+		s.tileSize = size
+		s.tileOrder = order
+	}
+}
+
+// WithProgressive is an optional parameter that renders one sample per pixel
+// per pass and hands a snapshot of the image to snapshot every passes passes
+// or every interval, whichever comes first. Zero disables either trigger. An
+// error from snapshot stops the render.
+func WithProgressive(passes int, interval time.Duration, snapshot func(*Film) error) func(*Scene) {
+	return func(s *Scene) {
+		s.progressive = true
+		s.snapshotPasses = passes
+		s.snapshotInterval = interval
+		s.snapshot = snapshot
+	}
+}
+
+// WithAdaptive is an optional parameter that takes between min and max
+// samples per pixel, stopping once the relative error of a pixel drops below
+// threshold. It replaces the fixed ns*ns samples per pixel.
+func WithAdaptive(min, max int, threshold float64) func(*Scene) {
+	return func(s *Scene) {
+		if min < 2 {
+			min = 2
+		}
+		if max < min {
+			max = min
+		}
+		s.adaptive = true
+		s.minSamples = min
+		s.maxSamples = max
+		s.threshold = threshold
+	}
+}
+
+// WithAOVs is an optional parameter that also renders the given AOVs. They
+// are added to the image as OpenEXR layers and returned by AOV.
+func WithAOVs(aovs ...AOV) func(*Scene) {
+	return func(s *Scene) {
+		s.outputAOVs = nil
+		for _, a := range aovs {
+			if !containsAOV(s.outputAOVs, a) {
+				s.outputAOVs = append(s.outputAOVs, a)
 			}
-			if bounce, scattered := m.Scatter(r, &attenuation, &rec, depth, nil, false); bounce {
-				if rec.Reflective().NotBlack() {
-					return emit.Add(finalColor).Add(rec.Reflective().Multiply(s.shade(scattered, obj, depth+1)))
-				}
+		}
+	}
+}
+
+// WithDenoiser is an optional parameter that removes the noise from the
+// rendered image with denoiser. The normal, albedo and depth AOVs it is
+// guided by are rendered even if they are not requested.
+func WithDenoiser(denoiser *postprocess.Denoiser) func(*Scene) {
+	return func(s *Scene) {
+		s.denoiser = denoiser
+	}
+}
+
+// WithCropWindow is an optional parameter that only renders the pixels inside
+// window, in image coordinates with y counting down from the top. The
+// rendered images only hold the window unless WithComposite is given.
+func WithCropWindow(window image.Rectangle) func(*Scene) {
+	return func(s *Scene) {
+		s.cropWindow = window
+	}
+}
+
+// WithComposite is an optional parameter that returns the existing image at
+// path with the crop window replaced by the render as the rendered image. The
+// AOVs and the sample counts keep the full size.
+func WithComposite(path string) func(*Scene) {
+	return func(s *Scene) {
+		s.composite = path
+	}
+}
+
+// WithCheckpoint is an optional parameter that saves the state of the render
+// to path every interval so it can be resumed with WithResume if the process
+// dies. The checkpoint is removed once the render completes.
+func WithCheckpoint(path string, interval time.Duration) func(*Scene) {
+	return func(s *Scene) {
+		s.checkpoint = path
+		s.checkpointInterval = interval
+	}
+}
+
+// WithResume is an optional parameter that continues the render from the
+// checkpoint at path if there is one.
+func WithResume(path string) func(*Scene) {
+	return func(s *Scene) {
+		s.checkpoint = path
+		s.resume = true
+	}
+}
+
+// WithBVH is an optional parameter that puts the objects of the world into a
+// bounding volume hierarchy, so rays only test the objects along their way.
+func WithBVH() func(*Scene) {
+	return func(s *Scene) {
+		s.bvh = true
+	}
+}
+
+// WithProgress is an optional parameter that calls report with the progress
+// of the render whenever a tile is done, and once more when the render ends.
+// It is called from the goroutine that called Render.
+func WithProgress(report func(Progress)) func(*Scene) {
+	return func(s *Scene) {
+		s.progress = report
+	}
+}
+
+// Stats returns the statistics of the last render.
+func (s *Scene) Stats() Stats {
+	return s.stats
+}
+
+// World returns the objects that rays can hit.
+func (s *Scene) World() objects.Object {
+	return s.world
+}
+
+// Lights returns the lights that are sampled directly.
+func (s *Scene) Lights() []materials.Light {
+	return s.lights
+}
+
+// Background returns the radiance of a ray that escapes the scene.
+func (s *Scene) Background(r *primitives.Ray) textures.Color {
+	return s.background(r)
+}
+
+// Render renders the image in passes and returns it both as a film, which
+// keeps the linear radiance, and as a tone mapped 8-bit image. Every pass
+// splits the image into tiles that a pool of workers pulls from a shared
+// queue, so workers that finish cheap tiles early take over the remaining
+// ones instead of idling. Each tile is rendered into its own buffer and
+// merged into the scene's accumulation buffer and film once done. A normal
+// render takes all samples in a single pass, a progressive render takes one
+// sample per pixel per pass and periodically hands a snapshot of the image so
+// far to the snapshot callback. An adaptive render keeps adding samples to
+// the pixels whose estimated error is above the threshold until they reach
+// the maximum number of samples. The image is denoised if the scene has a
+// denoiser. With a crop window only the pixels inside it are rendered.
+// Nothing is written to disk except the checkpoint.
+//
+// Once ctx is done the workers stop after their current pixel and Render
+// returns the samples taken so far, every pixel averaged over the samples it
+// got, together with the error of ctx. The checkpoint of a stopped render is
+// kept so it can be resumed. A failed checkpoint does not stop the render
+// either, its error is returned with the image.
+func (s *Scene) Render(ctx context.Context) (*Film, image.Image, error) {
+	s.start = time.Now()
+	s.stats = Stats{BuildTime: s.stats.BuildTime}
+	s.accum = NewAccumulator(s.film.Width(), s.film.Height())
+	s.film.clear()
+	s.newAOVFilms()
+	if s.resume {
+		if err := s.loadCheckpoint(s.checkpoint); err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+	}
+	stopCheckpoints := func() error { return nil }
+	if s.checkpointInterval > 0 {
+		done := make(chan struct{})
+		errs := make(chan error, 1)
+		go func() {
+			errs <- s.checkpointEvery(s.checkpoint, s.checkpointInterval, done)
+		}()
+		var once sync.Once
+		var err error
+		stopCheckpoints = func() error {
+			once.Do(func() {
+				close(done)
+				err = <-errs
+			})
+			return err
+		}
+		defer stopCheckpoints()
+	}
+	tiles := s.tiles()
+	perPass := s.ns * s.ns
+	if s.adaptive {
+		perPass = s.minSamples
+	}
+	if s.progressive {
+		perPass = 1
+	}
+	s.countSamples(tiles)
+
+	lastSnapshot := time.Now()
+	for pass := 1; ctx.Err() == nil && s.renderPass(ctx, tiles, perPass) > 0; pass++ {
+		if !s.progressive || s.snapshot == nil {
+			continue
+		}
+		if (s.snapshotPasses > 0 && pass%s.snapshotPasses == 0) ||
+			(s.snapshotInterval > 0 && time.Since(lastSnapshot) >= s.snapshotInterval) {
+			film, err := s.output()
+			if err == nil {
+				err = s.snapshot(film)
 			}
-			return emit.Add(finalColor)
+			if err != nil {
+				return nil, nil, err
+			}
+			lastSnapshot = time.Now()
 		}
-		return emit
 	}
 
-	return textures.Black
+	s.stats.RenderTime = time.Since(s.start)
+	if ctx.Err() == nil {
+		// Adaptive renders stop short of the total.
+		s.total = s.done
+	}
+	s.reportProgress()
+
+	checkpointErr := stopCheckpoints()
+	if s.checkpointInterval > 0 {
+		if ctx.Err() == nil {
+			os.Remove(s.checkpoint)
+		} else if err := s.saveCheckpoint(s.checkpoint); err != nil && checkpointErr == nil {
+			checkpointErr = err
+		}
+	}
+	film, err := s.output()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return film, film.Image(), err
+	}
+	return film, film.Image(), checkpointErr
+}
+
+// output returns a copy of the rendered image, denoised and cropped or
+// composited.
+func (s *Scene) output() (*Film, error) {
+	film := s.cropped(s.denoised())
+	if film == s.film {
+		film = film.crop(film.Rect)
+	}
+	if s.composite == "" {
+		return film, nil
+	}
+	return s.compositeOver(film)
+}
+
+// AOV returns the film of an AOV of the last render, cropped like the image,
+// or nil if it was not requested.
+func (s *Scene) AOV(a AOV) *Film {
+	if !containsAOV(s.outputAOVs, a) {
+		return nil
+	}
+	return s.cropped(s.aovFilms[a])
+}
+
+// SampleCounts returns a grayscale image of the number of samples the last
+// render took per pixel relative to the largest count, cropped like the
+// image. The weight of every pixel is its count.
+func (s *Scene) SampleCounts() *Film {
+	return s.cropped(s.sampleCounts())
 }
 
-// Render ...
-func (s *Scene) Render(fileName string, random bool) {
+// renderPass takes up to n more samples of every pixel that still needs them
+// and returns the number of samples taken. Finished tiles are merged in the
+// order of tiles, so the sums of pixels that the filter of several tiles
+// reaches are added up the same way no matter which worker finishes first.
+// Once ctx is done the remaining pixels are skipped.
+func (s *Scene) renderPass(ctx context.Context, tiles []image.Rectangle, n int) int64 {
+	queue := make(chan int, len(tiles))
+	for i := range tiles {
+		queue <- i
+	}
+	close(queue)
+
 	// Parallelization
 	var wg sync.WaitGroup
-	numCPU := runtime.NumCPU()
-
-	for cpu := 0; cpu < numCPU; cpu++ {
+	var taken int64
+	results := make(chan *tileResult, len(tiles))
+	for cpu := 0; cpu < runtime.NumCPU(); cpu++ {
 		wg.Add(1)
-		go func(column int) {
-			for j := column; j < s.film.Height(); j += numCPU {
-				for i := 0; i < s.film.Width(); i++ {
-					color := textures.NewEmptyColor()
-					for k := 0; k < s.ns*s.ns; k++ {
-						var u, v float64
-						if s.ns == 1 {
-							u = (float64(i) + 0.5) / float64(s.film.Width())
-							v = (float64(j) + 0.5) / float64(s.film.Height())
-						} else {
-							u = (float64(i) + rand.Float64()) / float64(s.film.Width())
-							v = (float64(j) + rand.Float64()) / float64(s.film.Height())
-						}
-						r := s.camera.GetRay(u, v)
-						if random {
-							color = color.Add(s.shadeRandom(r, s.world, 0))
-						} else {
-							color = color.Add(s.shade(r, s.world, 0))
-						}
-					}
-					color = color.DivideScalar(float64(s.ns * s.ns))
-					color = color.Clip()
-					// Gamma correction
-					color = textures.NewColor(math.Sqrt(color.R),
-						math.Sqrt(color.G),
-						math.Sqrt(color.B))
-					ir := byte(255 * color.R)
-					ig := byte(255 * color.G)
-					ib := byte(255 * color.B)
-					s.film.Set(i, j, ir, ig, ib)
-				}
+		go func() {
+			sampler := s.sampler.Clone()
+			for i := range queue {
+				result := s.renderTile(ctx, tiles[i], n, sampler)
+				result.index = i
+				atomic.AddInt64(&taken, int64(result.taken))
+				results <- result
 			}
 			wg.Done()
-		}(cpu)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]*tileResult)
+	next := 0
+	for result := range results {
+		pending[result.index] = result
+		for result, ok := pending[next]; ok; result, ok = pending[next] {
+			delete(pending, next)
+			s.mu.Lock()
+			s.accum.Merge(result.accum, result.tile.Min.X, result.tile.Min.Y)
+			s.film.merge(result.film)
+			for _, a := range s.aovs {
+				s.aovFilms[a].merge(result.aovs[a])
+			}
+			s.stats.merge(&result.stats)
+			s.done += int64(result.taken)
+			s.mu.Unlock()
+			s.reportProgress()
+			next++
+		}
 	}
+	return taken
+}
 
-	wg.Wait()
-	s.film.Save(fileName)
+// tileResult holds the samples taken for a tile until they are merged.
+type tileResult struct {
+	index, taken int
+	tile         image.Rectangle
+	accum        *Accumulator
+	film         *filmTile
+	aovs         [numAOVs]*filmTile
+	stats        Stats
 }
 
-// Backup
-// // TODO add func options to have a variety of backgrounds.
-func (s *Scene) shadeRandom(r *primitives.Ray, obj objects.Object, depth int) textures.Color {
-	var rec materials.HitRecord
-	if obj.Hit(r, 0.001, math.MaxFloat64, &rec) {
-		m := rec.Material()
-		emit := m.Emitted(rec.U(), rec.V(), rec.Point())
-		if depth < s.depth {
-			var attenuation textures.Color
-			if bounce, scattered := m.Scatter(r, &attenuation, &rec, depth, nil, false); bounce {
-				return emit.Add(attenuation.Multiply(s.shadeRandom(scattered, obj, depth+1)))
+// renderTile takes up to n more samples of the pixels of tile. Once ctx is
+// done it returns the samples taken so far, so every tile still yields a
+// result and the merge order holds.
+func (s *Scene) renderTile(ctx context.Context, tile image.Rectangle, n int, sampler sampling.Sampler) *tileResult {
+	result := &tileResult{tile: tile, accum: NewAccumulator(tile.Dx(), tile.Dy()),
+		film: s.film.newTile(tile)}
+	for _, a := range s.aovs {
+		result.aovs[a] = s.aovFilms[a].newTile(tile)
+	}
+	for j := tile.Min.Y; j < tile.Max.Y; j++ {
+		for i := tile.Min.X; i < tile.Max.X; i++ {
+			if ctx.Err() != nil {
+				return result
 			}
-			return emit.Add(attenuation)
+			first := s.accum.Count(i, j)
+			samples := s.pixelSamples(i, j, n)
+			for k := first; k < first+samples; k++ {
+				var aov AOVRecord
+				var counts RayCounts
+				c, alpha, x, y := s.samplePixel(i, j, k, sampler, &aov, &counts)
+				result.accum.AddSample(i-tile.Min.X, j-tile.Min.Y, c)
+				result.film.AddSample(x, y, c, alpha)
+				s.addAOVs(&result.aovs, &aov, x, y, k)
+				result.stats.add(&counts)
+			}
+			result.taken += samples
 		}
-		return emit
 	}
+	return result
+}
 
-	// Background color gradient. We use this to simulate light coming from the sky.
-	unitDirection := r.Direction().Normalize()
-	t := 0.5 * (unitDirection.Y() + 1.0)
-	return textures.Gradient(t)
+// countSamples sets the total number of samples of the pixels of tiles and
+// how many of them have already been taken.
+func (s *Scene) countSamples(tiles []image.Rectangle) {
+	limit := s.ns * s.ns
+	if s.adaptive {
+		limit = s.maxSamples
+	}
+	s.done, s.total = 0, 0
+	for _, tile := range tiles {
+		s.total += int64(tile.Dx() * tile.Dy() * limit)
+		for j := tile.Min.Y; j < tile.Max.Y; j++ {
+			for i := tile.Min.X; i < tile.Max.X; i++ {
+				s.done += int64(s.accum.Count(i, j))
+			}
+		}
+	}
+	s.resumed = s.done
+}
+
+// reportProgress calls the progress callback if there is one.
+func (s *Scene) reportProgress() {
+	if s.progress != nil {
+		s.progress(Progress{s.done, s.total, time.Since(s.start), s.resumed})
+	}
+}
+
+// pixelSamples returns how many of the n samples of a pass pixel (i, j)
+// takes.
+func (s *Scene) pixelSamples(i, j, n int) int {
+	count := s.accum.Count(i, j)
+	limit := s.ns * s.ns
+	if s.adaptive {
+		limit = s.maxSamples
+		if count >= s.minSamples && s.accum.Error(i, j) <= s.threshold {
+			return 0
+		}
+	}
+	if count+n > limit {
+		n = limit - count
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// sampleCounts returns a grayscale image of the number of samples taken per
+// pixel relative to the largest count. The weight of every pixel is its
+// count.
+func (s *Scene) sampleCounts() *Film {
+	film := NewFilm(s.film.Width(), s.film.Height())
+	max := 1
+	for j := 0; j < film.Height(); j++ {
+		for i := 0; i < film.Width(); i++ {
+			if count := s.accum.Count(i, j); count > max {
+				max = count
+			}
+		}
+	}
+	for j := 0; j < film.Height(); j++ {
+		for i := 0; i < film.Width(); i++ {
+			count := s.accum.Count(i, j)
+			c := float64(count) / float64(max)
+			film.Set(i, j, textures.NewColor(c, c, c), 1, float64(count))
+		}
+	}
+	return film
+}
+
+// samplePixel returns the radiance and alpha of sample k of pixel (i, j) and
+// the film position it was taken at. Samples the camera has no ray for are
+// black and transparent, blocked samples of weighted cameras are black. The
+// AOVs of the sample are recorded in aov and the rays it traced in counts.
+func (s *Scene) samplePixel(i, j, k int, sampler sampling.Sampler, aov *AOVRecord, counts *RayCounts) (textures.Color, float64, float64, float64) {
+	sampler.StartSample(i, j, k)
+	x, y := float64(i)+0.5, float64(j)+0.5
+	if s.ns != 1 || s.adaptive {
+		du, dv := sampler.Get2D()
+		x, y = float64(i)+du, float64(j)+dv
+	}
+	u, v := x/float64(s.film.Width()), y/float64(s.film.Height())
+	if camera, ok := s.camera.(WeightedCamera); ok {
+		r, weight := camera.GetWeightedRay(u, v, sampler)
+		if weight == 0 {
+			return textures.Black, 1, x, y
+		}
+		return s.integrator.Li(r, s, sampler, aov, counts).MultiplyScalar(weight), 1, x, y
+	}
+	r := s.camera.GetRay(u, v, sampler)
+	if r == nil {
+		return textures.Black, 0, x, y
+	}
+	return s.integrator.Li(r, s, sampler, aov, counts), 1, x, y
 }
@@ -0,0 +1,402 @@
+package base
+
+import (
+	"context"
+	"image"
+	"math"
+	"path/filepath"
+	"raytracer/filters"
+	"raytracer/materials"
+	"raytracer/objects"
+	"raytracer/postprocess"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"raytracer/textures"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testScene(options ...func(*Scene)) *Scene {
+	world := objects.NewEmptyObjectList(4)
+	world.Add(objects.NewSphere(primitives.NewVec3(0, -100.5, -1), 100,
+		materials.NewLambertian(textures.NewColor(0.5, 0.5, 0.5))))
+	world.Add(objects.NewSphere(primitives.NewVec3(0, 0, -1), 0.5,
+		materials.NewMetal(textures.NewColor(0.8, 0.6, 0.2), 0.3)))
+	world.Add(objects.NewSphere(primitives.NewVec3(-1, 0, -1), 0.5,
+		materials.NewDielectric(1.5)))
+	world.Add(objects.NewSphere(primitives.NewVec3(1, 2, -1), 0.5,
+		materials.NewDiffuseLight(textures.NewColor(4, 4, 4))))
+	camera := NewCameraFOV(primitives.NewVec3(0, 0, 2), primitives.NewVec3(0, 0, -1),
+		primitives.UnitY, 60, 1, 0.1, 3, 0, 1)
+	camera.ToggleBlur()
+	options = append([]func(*Scene){WithBackground(SkyBackground), WithSeed(7)}, options...)
+	s := NewScene(camera, NewFilm(16, 16), world, nil, 2, 10, options...)
+	s.accum = NewAccumulator(16, 16)
+	return s
+}
+
+func renderPasses(s *Scene, passes, n int) {
+	tiles := s.tiles()
+	for pass := 0; pass < passes && s.renderPass(context.Background(), tiles, n) > 0; pass++ {
+	}
+}
+
+func sameImage(t *testing.T, a, b *Scene) {
+	for j := 0; j < a.film.Height(); j++ {
+		for i := 0; i < a.film.Width(); i++ {
+			if a.accum.Count(i, j) != b.accum.Count(i, j) || a.accum.Mean(i, j) != b.accum.Mean(i, j) {
+				t.Fatalf("pixel (%d, %d) differs: %v != %v", i, j,
+					a.accum.Mean(i, j), b.accum.Mean(i, j))
+			}
+			if a.film.Pixel(i, j) != b.film.Pixel(i, j) {
+				t.Fatalf("film pixel (%d, %d) differs: %v != %v", i, j,
+					a.film.Pixel(i, j), b.film.Pixel(i, j))
+			}
+		}
+	}
+}
+
+func TestRenderIsReproducible(t *testing.T) {
+	a := testScene(WithTiles(4, HilbertOrder))
+	b := testScene(WithTiles(5, SpiralOrder))
+	renderPasses(a, 10, 4)
+	renderPasses(b, 10, 4)
+	sameImage(t, a, b)
+}
+
+func TestResumeIsBitIdentical(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.checkpoint")
+	uninterrupted := testScene()
+	renderPasses(uninterrupted, 10, 1)
+
+	interrupted := testScene()
+	renderPasses(interrupted, 2, 1)
+	if err := interrupted.saveCheckpoint(path); err != nil {
+		t.Fatal(err)
+	}
+	resumed := testScene()
+	if err := resumed.loadCheckpoint(path); err != nil {
+		t.Fatal(err)
+	}
+	renderPasses(resumed, 10, 1)
+	sameImage(t, uninterrupted, resumed)
+
+	if err := testScene(WithSeed(8)).loadCheckpoint(path); err == nil {
+		t.Error("resumed a checkpoint rendered with another seed")
+	}
+}
+
+func TestAOVs(t *testing.T) {
+	s := testScene(WithAOVs(AOVNormal, AOVMaterialID, AOVObjectID, AOVDirect, AOVIndirect))
+	s.newAOVFilms()
+	renderPasses(s, 1, 4)
+	hits := 0
+	for j := 0; j < s.film.Height(); j++ {
+		for i := 0; i < s.film.Width(); i++ {
+			c := s.film.Pixel(i, j).Color
+			split := s.aovFilms[AOVDirect].Pixel(i, j).Color.Add(s.aovFilms[AOVIndirect].Pixel(i, j).Color)
+			if math.Abs(c.R-split.R) > 1e-9 || math.Abs(c.B-split.B) > 1e-9 {
+				t.Fatalf("direct and indirect of pixel (%d, %d) add up to %v, want %v", i, j, split, c)
+			}
+			object := s.aovFilms[AOVObjectID].Pixel(i, j)
+			if object.Weight == 0 {
+				continue
+			}
+			hits++
+			if id := object.Color.R; id < 1 || id > 4 || id != math.Floor(id) {
+				t.Errorf("pixel (%d, %d) has object id %v", i, j, id)
+			}
+			if id := s.aovFilms[AOVMaterialID].Pixel(i, j).Color.R; id < 1 || id > 4 {
+				t.Errorf("pixel (%d, %d) has material id %v", i, j, id)
+			}
+			n := s.aovFilms[AOVNormal].Pixel(i, j).Color
+			if l := n.R*n.R + n.G*n.G + n.B*n.B; l > 1+1e-9 {
+				t.Errorf("pixel (%d, %d) has normal %v", i, j, n)
+			}
+		}
+	}
+	if hits == 0 {
+		t.Error("no camera ray hit the scene")
+	}
+}
+
+func TestDenoiserRendersGuides(t *testing.T) {
+	s := testScene(WithAOVs(AOVDirect), WithDenoiser(postprocess.NewDenoiser(3)))
+	s.newAOVFilms()
+	if len(s.film.layers) != 1 {
+		t.Fatalf("image has %d layers, want only the requested aov", len(s.film.layers))
+	}
+	renderPasses(s, 1, 4)
+	for _, a := range guideAOVs {
+		if s.aovFilms[a] == nil {
+			t.Fatalf("guide %v is not rendered", a)
+		}
+	}
+	denoised := s.denoised()
+	for j := 0; j < s.film.Height(); j++ {
+		for i := 0; i < s.film.Width(); i++ {
+			if p, q := s.film.Pixel(i, j), denoised.Pixel(i, j); p.Weight != q.Weight ||
+				math.Abs(p.Alpha-q.Alpha) > 1e-9 {
+				t.Fatalf("denoised pixel (%d, %d) is %v, was %v", i, j, q, p)
+			}
+		}
+	}
+}
+
+func TestCropWindowMatchesFullRender(t *testing.T) {
+	full := testScene()
+	full.film.SetFilter(filters.NewTent(1.5))
+	renderPasses(full, 1, 4)
+	window := image.Rect(5, 3, 11, 9)
+	crop := testScene(WithCropWindow(window))
+	crop.film.SetFilter(filters.NewTent(1.5))
+	renderPasses(crop, 1, 4)
+
+	a, b := full.film.crop(crop.window()), crop.cropped(crop.film)
+	if b.Width() != 6 || b.Height() != 6 {
+		t.Fatalf("cropped image is %dx%d, want 6x6", b.Width(), b.Height())
+	}
+	for j := 0; j < a.Height(); j++ {
+		for i := 0; i < a.Width(); i++ {
+			p, q := a.Pixel(i, j), b.Pixel(i, j)
+			if math.Abs(p.Color.R-q.Color.R) > 1e-9 || math.Abs(p.Weight-q.Weight) > 1e-9 {
+				t.Fatalf("pixel (%d, %d) of the window is %v, want %v", i, j, q, p)
+			}
+		}
+	}
+	if crop.film.Pixel(0, 0).Weight != 0 {
+		t.Error("a pixel outside the window was rendered")
+	}
+}
+
+func TestParseCropWindow(t *testing.T) {
+	for spec, want := range map[string]image.Rectangle{
+		"10,20,30,40":        image.Rect(10, 20, 30, 40),
+		"0,50%,25%,100%":     image.Rect(0, 50, 25, 100),
+		"10%, 10%, 30%, 30%": image.Rect(10, 10, 30, 30),
+		"90,90,200,200":      image.Rect(90, 90, 100, 100),
+		"0,0,1,1":            image.Rect(0, 0, 1, 1),
+		"0,0,1,2":            image.Rect(0, 0, 1, 2),
+		"0%,0%,100%,100%":    image.Rect(0, 0, 100, 100),
+		"0.5%,0,33.3%,1":     image.Rect(1, 0, 34, 1),
+		"7%,14%,28%,55%":     image.Rect(7, 14, 28, 55),
+		"0,0,56%,56%":        image.Rect(0, 0, 56, 56),
+	} {
+		if got, err := ParseCropWindow(spec, 100, 100); err != nil || got != want {
+			t.Errorf("ParseCropWindow(%q) = %v, %v, want %v", spec, got, err, want)
+		}
+	}
+	for _, spec := range []string{"1,2,3", "a,b,c,d", "200,200,300,300", "5,5,5,9", "0,0.5,0.25,1", "0,0,x%,1"} {
+		if _, err := ParseCropWindow(spec, 100, 100); err == nil {
+			t.Errorf("ParseCropWindow(%q) did not fail", spec)
+		}
+	}
+}
+
+// countdown is a context that is cancelled after n checks.
+type countdown struct {
+	context.Context
+	n int64
+}
+
+func (c *countdown) Err() error {
+	if atomic.AddInt64(&c.n, -1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCancelledRenderKeepsSamples(t *testing.T) {
+	s := testScene()
+	s.renderPass(&countdown{context.Background(), 100}, s.tiles(), 4)
+	rendered := 0
+	for j := 0; j < s.film.Height(); j++ {
+		for i := 0; i < s.film.Width(); i++ {
+			count, p := s.accum.Count(i, j), s.film.Pixel(i, j)
+			if count != 0 && count != 4 {
+				t.Fatalf("pixel (%d, %d) was stopped after %d samples", i, j, count)
+			}
+			if count == 0 {
+				if p.Weight != 0 {
+					t.Fatalf("pixel (%d, %d) has weight %v without samples", i, j, p.Weight)
+				}
+				continue
+			}
+			rendered++
+			if mean := s.accum.Mean(i, j); math.Abs(p.Color.R-mean.R) > 1e-9 || p.Weight != 4 {
+				t.Fatalf("pixel (%d, %d) is %v, want the mean %v of its samples", i, j, p, mean)
+			}
+		}
+	}
+	if rendered == 0 || rendered == s.film.Width()*s.film.Height() {
+		t.Errorf("%d pixels were rendered before the cancel", rendered)
+	}
+}
+
+func TestCompositeKeepsUnrenderedPixels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "under.png")
+	under := NewFilm(16, 16)
+	for j := 0; j < 16; j++ {
+		for i := 0; i < 16; i++ {
+			under.Set(i, j, textures.NewColor(0.2, 0.4, 0.6), 1, 1)
+		}
+	}
+	if err := under.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	original, err := loadFilm(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := testScene(WithCropWindow(image.Rect(2, 2, 14, 14)), WithComposite(path))
+	s.renderPass(&countdown{context.Background(), 50}, s.tiles(), 4)
+	out, err := s.compositeOver(s.film)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := 0
+	window := s.window()
+	for j := window.Min.Y; j < window.Max.Y; j++ {
+		for i := window.Min.X; i < window.Max.X; i++ {
+			if s.film.Pixel(i, j).Weight != 0 {
+				continue
+			}
+			kept++
+			if p, want := out.Pixel(i, j), original.Pixel(i, j); p != want {
+				t.Fatalf("unrendered pixel (%d, %d) is %v, want %v", i, j, p, want)
+			}
+		}
+	}
+	if kept == 0 {
+		t.Error("the render reached every pixel of the window before the cancel")
+	}
+}
+
+func TestLightPDFOfHitLight(t *testing.T) {
+	light := materials.NewDiffuseLight(textures.NewColor(1, 1, 1))
+	front := objects.NewRectangleXY(-1, 1, -1, 1, -2, light)
+	back := objects.NewRectangleXY(-2, 2, -2, 2, -4, light)
+	world := objects.NewEmptyObjectList(2)
+	world.Add(front)
+	world.Add(back)
+	s := NewScene(NewCameraFOV(primitives.NewVec3(0, 0, 0), primitives.NewVec3(0, 0, -1),
+		primitives.UnitY, 60, 1, 0, 1, 0, 1), NewFilm(1, 1), world, nil, 1, 1)
+
+	// The direction points at both lights, but only the front one is hit.
+	origin, direction := primitives.NewVec3(0, 0, 0), primitives.NewVec3(0, 0, -1)
+	var rec materials.HitRecord
+	if !s.World().Hit(primitives.NewRay(origin, direction), 0.001, math.MaxFloat64, &rec) {
+		t.Fatal("missed the lights")
+	}
+	want := front.PDF(origin, direction)
+	if pdf := NewPathTracer(1, 1).lightPDF(origin, direction, &rec, s); math.Abs(pdf-want) > 1e-9 {
+		t.Errorf("light pdf is %v, want %v of the front light alone", pdf, want)
+	}
+}
+
+func TestBVHKeepsImage(t *testing.T) {
+	list := testScene(WithAOVs(AOVObjectID))
+	bvh := testScene(WithAOVs(AOVObjectID), WithBVH())
+	if _, ok := bvh.world.(*objects.BVHNode); !ok {
+		t.Fatalf("world is a %T, want a BVH", bvh.world)
+	}
+	for _, s := range []*Scene{list, bvh} {
+		s.newAOVFilms()
+		renderPasses(s, 1, 4)
+	}
+	sameImage(t, list, bvh)
+	for j := 0; j < list.film.Height(); j++ {
+		for i := 0; i < list.film.Width(); i++ {
+			if a, b := list.aovFilms[AOVObjectID].Pixel(i, j), bvh.aovFilms[AOVObjectID].Pixel(i, j); a != b {
+				t.Fatalf("object id of pixel (%d, %d) is %v, want %v", i, j, b, a)
+			}
+		}
+	}
+}
+
+func TestStatsAndProgress(t *testing.T) {
+	var reports []Progress
+	s := testScene(WithBVH(), WithProgress(func(p Progress) { reports = append(reports, p) }))
+	tiles := s.tiles()
+	s.countSamples(tiles)
+	s.renderPass(context.Background(), tiles, 4)
+
+	st := s.Stats()
+	if st.PrimaryRays != 16*16*4 {
+		t.Errorf("traced %d primary rays, want %d", st.PrimaryRays, 16*16*4)
+	}
+	if st.Bounces == 0 || st.ShadowRays == 0 || st.NodeTests == 0 || st.PrimitiveTests == 0 {
+		t.Errorf("counted nothing: %+v", st)
+	}
+	if depth := st.AverageDepth(); depth < 1 || depth > 11 {
+		t.Errorf("average depth is %v", depth)
+	}
+	if len(reports) != len(tiles) {
+		t.Fatalf("got %d progress reports for %d tiles", len(reports), len(tiles))
+	}
+	for i, p := range reports {
+		if p.Total != 16*16*4 {
+			t.Fatalf("report %d has a total of %d samples", i, p.Total)
+		}
+		if i > 0 && p.Samples <= reports[i-1].Samples {
+			t.Fatalf("report %d is %+v after %+v", i, p, reports[i-1])
+		}
+	}
+	if last := reports[len(reports)-1]; last.Fraction() != 1 {
+		t.Errorf("render ended at %v", last.Fraction())
+	}
+}
+
+// leftCamera only has rays for the left half of the image.
+type leftCamera struct {
+	camera *Camera
+}
+
+func (c leftCamera) GetRay(u, v float64, sampler sampling.Sampler) *primitives.Ray {
+	if u < 0.5 {
+		return c.camera.GetRay(u, v, sampler)
+	}
+	return nil
+}
+
+func (c leftCamera) Shutter() (float64, float64) {
+	return c.camera.Shutter()
+}
+
+func TestStatsSkipSamplesWithoutRay(t *testing.T) {
+	s := testScene()
+	s.camera = leftCamera{s.camera.(*Camera)}
+	s.renderPass(context.Background(), s.tiles(), 4)
+	if st := s.Stats(); st.PrimaryRays != 16*16*4/2 {
+		t.Errorf("traced %d primary rays, want %d", st.PrimaryRays, 16*16*4/2)
+	}
+}
+
+func TestRenderReturnsImage(t *testing.T) {
+	s := testScene(WithCheckpoint(filepath.Join(t.TempDir(), "test.checkpoint"), time.Hour))
+	film, img, err := s.Render(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if film == s.film {
+		t.Error("the returned film is reused by the next render")
+	}
+	if img.Bounds() != film.Bounds() {
+		t.Fatalf("image bounds are %v, want %v", img.Bounds(), film.Bounds())
+	}
+	for y := 0; y < film.Height(); y++ {
+		for x := 0; x < film.Width(); x++ {
+			if a, b := img.At(x, y), film.At(x, y); a != b {
+				t.Fatalf("image pixel (%d, %d) is %v, want %v", x, y, a, b)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if film, _, err := s.Render(ctx); film == nil || err != context.Canceled {
+		t.Errorf("cancelled render returned %v, %v", film, err)
+	}
+}
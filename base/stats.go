@@ -0,0 +1,129 @@
+package base
+
+import (
+	"fmt"
+	"raytracer/materials"
+	"time"
+)
+
+// Stats are the statistics of a render. Every camera sample traces a primary
+// ray, the bounces of its path and the shadow rays towards the lights, the
+// latter two being the secondary rays.
+type Stats struct {
+	PrimaryRays, Bounces, ShadowRays int64
+	// NodeTests and PrimitiveTests count the intersection tests with the
+	// nodes of the BVH and with shapes.
+	NodeTests, PrimitiveTests int64
+	BuildTime, RenderTime     time.Duration
+}
+
+// SecondaryRays returns the number of rays that were not traced from the
+// camera.
+func (st Stats) SecondaryRays() int64 {
+	return st.Bounces + st.ShadowRays
+}
+
+// RaysPerSecond returns the number of rays traced per second of rendering.
+func (st Stats) RaysPerSecond() float64 {
+	if st.RenderTime <= 0 {
+		return 0
+	}
+	return float64(st.PrimaryRays+st.SecondaryRays()) / st.RenderTime.Seconds()
+}
+
+// AverageDepth returns the average number of segments of a path, counting the
+// primary ray.
+func (st Stats) AverageDepth() float64 {
+	if st.PrimaryRays == 0 {
+		return 0
+	}
+	return float64(st.PrimaryRays+st.Bounces) / float64(st.PrimaryRays)
+}
+
+func (st Stats) String() string {
+	return fmt.Sprintf("Rays:           %d primary, %d secondary (%d shadow)\n"+
+		"Rays/sec:       %.0f\n"+
+		"Intersections:  %d BVH nodes, %d primitives\n"+
+		"Average depth:  %.2f\n"+
+		"Time:           %v BVH build, %v rendering",
+		st.PrimaryRays, st.SecondaryRays(), st.ShadowRays, st.RaysPerSecond(),
+		st.NodeTests, st.PrimitiveTests, st.AverageDepth(),
+		st.BuildTime.Round(time.Microsecond), st.RenderTime.Round(time.Millisecond))
+}
+
+// RayCounts collects the rays of the path of a camera sample and their
+// intersection tests while the integrator traces it.
+type RayCounts struct {
+	rays, shadowRays  int
+	nodes, primitives int
+}
+
+// AddRay records a ray of the path, whose intersection tests were counted in
+// rec.
+func (c *RayCounts) AddRay(rec *materials.HitRecord) {
+	c.rays++
+	c.addTests(rec)
+}
+
+// AddShadowRay records a shadow ray, whose intersection tests were counted in
+// rec.
+func (c *RayCounts) AddShadowRay(rec *materials.HitRecord) {
+	c.shadowRays++
+	c.addTests(rec)
+}
+
+func (c *RayCounts) addTests(rec *materials.HitRecord) {
+	nodes, primitives := rec.Counts()
+	c.nodes += nodes
+	c.primitives += primitives
+}
+
+// add adds the rays of a camera sample to st. Samples the camera had no ray
+// for trace nothing and are not counted.
+func (st *Stats) add(counts *RayCounts) {
+	if counts.rays == 0 {
+		return
+	}
+	st.PrimaryRays++
+	st.Bounces += int64(counts.rays - 1)
+	st.ShadowRays += int64(counts.shadowRays)
+	st.NodeTests += int64(counts.nodes)
+	st.PrimitiveTests += int64(counts.primitives)
+}
+
+// merge adds the statistics of a tile to st.
+func (st *Stats) merge(tile *Stats) {
+	st.PrimaryRays += tile.PrimaryRays
+	st.Bounces += tile.Bounces
+	st.ShadowRays += tile.ShadowRays
+	st.NodeTests += tile.NodeTests
+	st.PrimitiveTests += tile.PrimitiveTests
+}
+
+// Progress tells how far a render has come. Samples counts the camera
+// samples taken, including the ones restored from a checkpoint, out of Total.
+// Adaptive renders count the maximum number of samples of every pixel, so
+// they usually finish early.
+type Progress struct {
+	Samples, Total int64
+	Elapsed        time.Duration
+	// resumed are the samples restored from a checkpoint.
+	resumed int64
+}
+
+// Fraction returns the part of the samples that has been taken.
+func (p Progress) Fraction() float64 {
+	if p.Total == 0 {
+		return 1
+	}
+	return float64(p.Samples) / float64(p.Total)
+}
+
+// ETA estimates the time left from the rate samples were taken at so far.
+func (p Progress) ETA() time.Duration {
+	taken := p.Samples - p.resumed
+	if taken <= 0 {
+		return 0
+	}
+	return time.Duration(float64(p.Elapsed) * float64(p.Total-p.Samples) / float64(taken))
+}
@@ -0,0 +1,166 @@
+package base
+
+import (
+	"fmt"
+	"math"
+	"raytracer/primitives"
+	"raytracer/sampling"
+)
+
+// StereoLayout is how the images of both eyes are packed into one image.
+type StereoLayout int
+
+// Supported stereo layouts.
+const (
+	// SideBySide puts the left eye in the left half of the image.
+	SideBySide StereoLayout = iota
+	// TopBottom puts the left eye in the top half of the image.
+	TopBottom
+)
+
+// ParseStereoLayout returns the stereo layout with the given name, sbs or tb.
+func ParseStereoLayout(name string) (StereoLayout, error) {
+	switch name {
+	case "sbs":
+		return SideBySide, nil
+	case "tb":
+		return TopBottom, nil
+	}
+	return SideBySide, fmt.Errorf("unknown stereo layout %q", name)
+}
+
+// EyeAspect returns the aspect ratio of the half of an image with the given
+// aspect ratio that one eye gets.
+func (l StereoLayout) EyeAspect(aspect float64) float64 {
+	if l == TopBottom {
+		return aspect * 2
+	}
+	return aspect / 2
+}
+
+// Stereo is a camera rig that renders a left and a right eye into the two
+// halves of one image.
+type Stereo struct {
+	left, right CameraModel
+	layout      StereoLayout
+}
+
+// NewStereoCamera returns a rig of two copies of c, moved interocular apart
+// along its horizontal axis. The eyes look in parallel and their views are
+// shifted so they line up at the convergence distance, which puts objects
+// there on the screen, nearer ones in front of it and farther ones behind.
+// A convergence of zero leaves the views unshifted, converging at infinity.
+// The aspect ratio of c should be that of one half of the image.
+func NewStereoCamera(c *Camera, interocular, convergence float64, layout StereoLayout) *Stereo {
+	return &Stereo{c.eye(-interocular/2, convergence), c.eye(interocular/2, convergence), layout}
+}
+
+// eye returns the camera moved offset along its horizontal axis with the view
+// shifted so the views of both eyes match at the convergence distance.
+func (c *Camera) eye(offset, convergence float64) *Camera {
+	eye := *c
+	shift := c.u.MultiplyScalar(offset)
+	eye.origin = c.origin.Add(shift)
+	// The view lies on the plane of focus, the views of both eyes have to
+	// cover the same window on the plane of convergence.
+	focus := c.origin.Subtract(c.ll.Add(c.horizontal.MultiplyScalar(0.5)).
+		Add(c.vertical.MultiplyScalar(0.5))).Dot(c.w)
+	if convergence > 0 && !c.orthographic {
+		shift = shift.MultiplyScalar(1 - focus/convergence)
+	}
+	eye.ll = c.ll.Add(shift)
+	return &eye
+}
+
+// NewODSCamera returns an omni-directional stereo rig of two equirectangular
+// cameras. Every column of the image is seen by eyes that sit on a circle
+// with a diameter of interocular around origin, on either side of the
+// direction of the column, so the image gives the right depth wherever the
+// viewer turns. A convergence of zero keeps the rays of the eyes parallel,
+// otherwise they meet at that distance.
+func NewODSCamera(origin, lookat, vup primitives.Vec3, interocular, convergence float64, layout StereoLayout, t0, t1 float64) *Stereo {
+	return odsRig(newFrame(origin, lookat, vup, t0, t1), interocular, convergence, layout)
+}
+
+func odsRig(f frame, interocular, convergence float64, layout StereoLayout) *Stereo {
+	return &Stereo{&odsEye{f, -interocular / 2, convergence},
+		&odsEye{f, interocular / 2, convergence}, layout}
+}
+
+// NewStereoRig returns the stereo rig of c: an off-axis rig for a perspective
+// camera or an omni-directional one for an equirectangular camera.
+func NewStereoRig(c CameraModel, interocular, convergence float64, layout StereoLayout) (*Stereo, error) {
+	switch c := c.(type) {
+	case *Camera:
+		if !c.orthographic {
+			return NewStereoCamera(c, interocular, convergence, layout), nil
+		}
+	case *Equirectangular:
+		return odsRig(c.frame, interocular, convergence, layout), nil
+	}
+	return nil, fmt.Errorf("stereo needs a perspective or equirectangular camera")
+}
+
+// Shutter returns the interval the camera is open.
+func (s *Stereo) Shutter() (float64, float64) {
+	return s.left.Shutter()
+}
+
+// eye returns the eye whose half of the image the film position (u, v) falls
+// in and the position on the film of that eye.
+func (s *Stereo) eye(u, v float64) (CameraModel, float64, float64) {
+	if s.layout == TopBottom {
+		if v >= 0.5 {
+			return s.left, u, 2*v - 1
+		}
+		return s.right, u, 2 * v
+	}
+	if u < 0.5 {
+		return s.left, 2 * u, v
+	}
+	return s.right, 2*u - 1, v
+}
+
+// GetRay returns the ray through the film position (u, v) of the eye whose
+// half of the image it falls in.
+func (s *Stereo) GetRay(u, v float64, sampler sampling.Sampler) *primitives.Ray {
+	eye, u, v := s.eye(u, v)
+	return eye.GetRay(u, v, sampler)
+}
+
+// GetWeightedRay returns the ray through the film position (u, v) of the eye
+// whose half of the image it falls in, with the weight it gets from a
+// vignetting eye.
+func (s *Stereo) GetWeightedRay(u, v float64, sampler sampling.Sampler) (*primitives.Ray, float64) {
+	eye, u, v := s.eye(u, v)
+	if eye, ok := eye.(WeightedCamera); ok {
+		return eye.GetWeightedRay(u, v, sampler)
+	}
+	if r := eye.GetRay(u, v, sampler); r != nil {
+		return r, 1
+	}
+	return nil, 0
+}
+
+// odsEye is one eye of an omni-directional stereo rig, offset to the right of
+// the direction of every ray, or to the left if negative.
+type odsEye struct {
+	frame
+	offset, convergence float64
+}
+
+// GetRay returns the ray through the film position (u, v).
+func (c *odsEye) GetRay(u, v float64, sampler sampling.Sampler) *primitives.Ray {
+	phi := 2 * math.Pi * (u - 0.5)
+	theta := math.Pi * (v - 0.5)
+	direction := primitives.NewVec3(math.Cos(theta)*math.Sin(phi), math.Sin(theta),
+		-math.Cos(theta)*math.Cos(phi))
+	eye := primitives.NewVec3(math.Cos(phi), 0, math.Sin(phi)).MultiplyScalar(c.offset)
+	if c.convergence > 0 {
+		direction = direction.MultiplyScalar(c.convergence).Subtract(eye)
+	}
+	r := c.ray(direction.X(), direction.Y(), direction.Z(), sampler)
+	r.Update(c.origin.Add(c.u.MultiplyScalar(eye.X())).Add(c.w.MultiplyScalar(eye.Z())),
+		r.Direction())
+	return r
+}
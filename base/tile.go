@@ -0,0 +1,104 @@
+package base
+
+import (
+	"fmt"
+	"image"
+)
+
+// TileOrder is the order in which the tiles of an image are rendered.
+type TileOrder int
+
+// Supported tile orders.
+const (
+	// ScanlineOrder renders tiles row by row.
+	ScanlineOrder TileOrder = iota
+	// HilbertOrder follows a Hilbert curve so consecutive tiles are always
+	// neighbours, which keeps the geometry they touch in cache.
+	HilbertOrder
+	// SpiralOrder starts in the center of the image and spirals outwards so
+	// the subject of the image finishes first.
+	SpiralOrder
+)
+
+// ParseTileOrder returns the tile order with the given name.
+func ParseTileOrder(name string) (TileOrder, error) {
+	switch name {
+	case "scanline":
+		return ScanlineOrder, nil
+	case "hilbert":
+		return HilbertOrder, nil
+	case "spiral":
+		return SpiralOrder, nil
+	}
+	return ScanlineOrder, fmt.Errorf("unknown tile order %q", name)
+}
+
+// Tiles splits a width x height image into size x size tiles, clipped to the
+// image, and returns them in the given order.
+func Tiles(width, height, size int, order TileOrder) []image.Rectangle {
+	if size < 1 {
+		size = 1
+	}
+	nx := (width + size - 1) / size
+	ny := (height + size - 1) / size
+	tiles := make([]image.Rectangle, 0, nx*ny)
+	add := func(x, y int) {
+		if x < 0 || y < 0 || x >= nx || y >= ny {
+			return
+		}
+		tile := image.Rect(x*size, y*size, (x+1)*size, (y+1)*size)
+		tiles = append(tiles, tile.Intersect(image.Rect(0, 0, width, height)))
+	}
+
+	switch order {
+	case HilbertOrder:
+		n := 1
+		for n < nx || n < ny {
+			n *= 2
+		}
+		for d := 0; d < n*n; d++ {
+			add(hilbert(n, d))
+		}
+	case SpiralOrder:
+		x, y := (nx-1)/2, (ny-1)/2
+		dx, dy := 1, 0
+		for step := 1; len(tiles) < nx*ny; step++ {
+			// Every step length is walked twice before it grows by one.
+			for turn := 0; turn < 2; turn++ {
+				for i := 0; i < step; i++ {
+					add(x, y)
+					x, y = x+dx, y+dy
+				}
+				dx, dy = -dy, dx
+			}
+		}
+	default:
+		for y := 0; y < ny; y++ {
+			for x := 0; x < nx; x++ {
+				add(x, y)
+			}
+		}
+	}
+	return tiles
+}
+
+// hilbert converts the distance d along a Hilbert curve filling an n x n grid
+// to grid coordinates. n must be a power of two.
+func hilbert(n, d int) (int, int) {
+	x, y := 0, 0
+	for s := 1; s < n; s *= 2 {
+		rx := 1 & (d / 2)
+		ry := 1 & (d ^ rx)
+		if ry == 0 {
+			if rx == 1 {
+				x = s - 1 - x
+				y = s - 1 - y
+			}
+			x, y = y, x
+		}
+		x += s * rx
+		y += s * ry
+		d /= 4
+	}
+	return x, y
+}
@@ -0,0 +1,38 @@
+package base
+
+import (
+	"image"
+	"testing"
+)
+
+func TestTilesCoverImage(t *testing.T) {
+	for _, order := range []TileOrder{ScanlineOrder, HilbertOrder, SpiralOrder} {
+		width, height := 100, 37
+		covered := make(map[image.Point]int)
+		for _, tile := range Tiles(width, height, 16, order) {
+			for y := tile.Min.Y; y < tile.Max.Y; y++ {
+				for x := tile.Min.X; x < tile.Max.X; x++ {
+					covered[image.Pt(x, y)]++
+				}
+			}
+		}
+		if len(covered) != width*height {
+			t.Errorf("order %d: covered %d of %d pixels", order, len(covered), width*height)
+		}
+		for p, n := range covered {
+			if n != 1 {
+				t.Errorf("order %d: pixel %v rendered %d times", order, p, n)
+			}
+		}
+	}
+}
+
+func TestHilbertNeighbours(t *testing.T) {
+	tiles := Tiles(128, 128, 16, HilbertOrder)
+	for i := 1; i < len(tiles); i++ {
+		d := tiles[i].Min.Sub(tiles[i-1].Min)
+		if d.X*d.X+d.Y*d.Y != 16*16 {
+			t.Errorf("tiles %d and %d are not neighbours", i-1, i)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package filters
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Filter is a pixel reconstruction filter. Every sample adds its radiance to
+// the pixels whose centers are less than Radius away along both axes,
+// weighted by Evaluate of the offset from the pixel center to the sample.
+type Filter interface {
+	Radius() float64
+	Evaluate(x, y float64) float64
+}
+
+// Parse returns the filter with the given name: box, tent, gaussian, mitchell
+// or lanczos. A radius of zero or less selects the default radius of the
+// filter.
+func Parse(name string, radius float64) (Filter, error) {
+	pick := func(def float64) float64 {
+		if radius > 0 {
+			return radius
+		}
+		return def
+	}
+	switch strings.ToLower(name) {
+	case "box":
+		return NewBox(pick(0.5)), nil
+	case "tent":
+		return NewTent(pick(1)), nil
+	case "gaussian":
+		return NewGaussian(pick(1.5), 0.5), nil
+	case "mitchell":
+		return NewMitchell(pick(2), 1.0/3, 1.0/3), nil
+	case "lanczos":
+		return NewLanczos(pick(3)), nil
+	}
+	return nil, fmt.Errorf("unknown filter %q", name)
+}
+
+// Box weighs all samples within the radius equally. A box of radius 0.5
+// averages the samples inside each pixel.
+type Box struct {
+	radius float64
+}
+
+// NewBox returns a new box filter.
+func NewBox(radius float64) *Box {
+	return &Box{radius}
+}
+
+// Radius ...
+func (f *Box) Radius() float64 {
+	return f.radius
+}
+
+// Evaluate ...
+func (f *Box) Evaluate(x, y float64) float64 {
+	// Half open so samples on the border between two pixels are only counted
+	// once.
+	if x < -f.radius || x >= f.radius || y < -f.radius || y >= f.radius {
+		return 0
+	}
+	return 1
+}
+
+// Tent falls off linearly from the center to the radius.
+type Tent struct {
+	radius float64
+}
+
+// NewTent returns a new tent filter.
+func NewTent(radius float64) *Tent {
+	return &Tent{radius}
+}
+
+// Radius ...
+func (f *Tent) Radius() float64 {
+	return f.radius
+}
+
+// Evaluate ...
+func (f *Tent) Evaluate(x, y float64) float64 {
+	return math.Max(0, f.radius-math.Abs(x)) * math.Max(0, f.radius-math.Abs(y))
+}
+
+// Gaussian is a Gaussian with standard deviation sigma, shifted down so it
+// reaches zero at the radius.
+type Gaussian struct {
+	radius, sigma, edge float64
+}
+
+// NewGaussian returns a new Gaussian filter.
+func NewGaussian(radius, sigma float64) *Gaussian {
+	f := &Gaussian{radius: radius, sigma: sigma}
+	f.edge = f.gaussian(radius)
+	return f
+}
+
+// Radius ...
+func (f *Gaussian) Radius() float64 {
+	return f.radius
+}
+
+// Evaluate ...
+func (f *Gaussian) Evaluate(x, y float64) float64 {
+	return math.Max(0, f.gaussian(x)-f.edge) * math.Max(0, f.gaussian(y)-f.edge)
+}
+
+func (f *Gaussian) gaussian(x float64) float64 {
+	return math.Exp(-x * x / (2 * f.sigma * f.sigma))
+}
+
+// Mitchell is the cubic Mitchell-Netravali filter with parameters b and c. Its
+// negative lobes sharpen edges, b = c = 1/3 is the recommended trade-off
+// between blurring and ringing.
+// [Mitchell and Netravali, Reconstruction Filters in Computer Graphics]
+type Mitchell struct {
+	radius, b, c float64
+}
+
+// NewMitchell returns a new Mitchell-Netravali filter.
+func NewMitchell(radius, b, c float64) *Mitchell {
+	return &Mitchell{radius, b, c}
+}
+
+// Radius ...
+func (f *Mitchell) Radius() float64 {
+	return f.radius
+}
+
+// Evaluate ...
+func (f *Mitchell) Evaluate(x, y float64) float64 {
+	return f.mitchell(2*x/f.radius) * f.mitchell(2*y/f.radius)
+}
+
+// mitchell evaluates the filter on [-2, 2].
+func (f *Mitchell) mitchell(x float64) float64 {
+	b, c := f.b, f.c
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+	case x < 2:
+		return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	}
+	return 0
+}
+
+// Lanczos is a sinc windowed by a wider sinc that reaches zero at the radius.
+type Lanczos struct {
+	radius float64
+}
+
+// NewLanczos returns a new Lanczos filter.
+func NewLanczos(radius float64) *Lanczos {
+	return &Lanczos{radius}
+}
+
+// Radius ...
+func (f *Lanczos) Radius() float64 {
+	return f.radius
+}
+
+// Evaluate ...
+func (f *Lanczos) Evaluate(x, y float64) float64 {
+	return f.lanczos(x) * f.lanczos(y)
+}
+
+func (f *Lanczos) lanczos(x float64) float64 {
+	if math.Abs(x) >= f.radius {
+		return 0
+	}
+	return sinc(x) * sinc(x/f.radius)
+}
+
+func sinc(x float64) float64 {
+	if math.Abs(x) < 1e-5 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -0,0 +1,44 @@
+package filters
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFilters(t *testing.T) {
+	for _, name := range []string{"box", "tent", "gaussian", "mitchell", "lanczos"} {
+		f, err := Parse(name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := f.Radius()
+		if f.Evaluate(0, 0) <= 0 {
+			t.Errorf("%s is not positive at the center", name)
+		}
+		integral := 0.0
+		const steps = 200
+		for i := 0; i < steps; i++ {
+			x := -r + 2*r*(float64(i)+0.5)/steps
+			if w := f.Evaluate(x, 0.1); math.Abs(w-f.Evaluate(-x, 0.1)) > 1e-12 {
+				t.Errorf("%s is not symmetric at %v", name, x)
+			}
+			integral += f.Evaluate(x, 0)
+			if w := f.Evaluate(r+0.01, x) + f.Evaluate(x, -r-0.01); w != 0 {
+				t.Errorf("%s is %v outside its radius", name, w)
+			}
+		}
+		if integral <= 0 {
+			t.Errorf("%s integrates to %v", name, integral)
+		}
+	}
+	if _, err := Parse("bogus", 0); err == nil {
+		t.Error("parsed an unknown filter")
+	}
+}
+
+func TestBoxCountsBordersOnce(t *testing.T) {
+	f := NewBox(0.5)
+	if f.Evaluate(-0.5, 0)+f.Evaluate(0.5, 0) != 1 {
+		t.Error("a sample on a pixel border is not counted exactly once")
+	}
+}
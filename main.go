@@ -1,11 +1,24 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"raytracer/base"
+	"raytracer/filters"
 	"raytracer/parsers"
+	"raytracer/postprocess"
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -17,49 +30,332 @@ func main() {
 	y := flag.Uint("y", 500, "Specifies the height of the image.")
 	aa := flag.Uint("aa", 8, "Sets the antialiasing amount.")
 	input := flag.String("f", "", "File to load.")
-	filename := flag.String("o", "output", "The filename.")
+	filename := flag.String("o", "output", "The filename, its extension selects the format: png, exr or pfm.")
 	random := flag.Bool("r", false, "Generate a random scene.")
 	blur := flag.Bool("blur", false, "Turns on camera blur, effects change based on camera.")
 	vfov := flag.Float64("vfov", 20, "Sets the camera fov, requires fovcam.")
 	distFocus := flag.Float64("dist", 1, "Sets the distance to focus.")
 	aperture := flag.Float64("apt", 0, "Sets the aperature of the camera, requires fovcam.")
 	fovcam := flag.Bool("fovcam", false, "Use a camera with a specified field of view.")
+	ortho := flag.Float64("ortho", 0, "Uses an orthographic camera that shows this many units across.")
+	pano := flag.String("pano", "", "Uses a panoramic camera: equirectangular, cubemap, fisheye or equisolid.")
+	panoFOV := flag.Float64("pfov", 180, "Sets the field of view of fisheye cameras, requires pano.")
+	bokeh := flag.String("bokeh", "", "Shapes the aperture as a polygon with this many blades or the mask in this image file, requires blur.")
+	bokehRotation := flag.Float64("bokehrot", 0, "Rotates the blades of the aperture by degrees, requires bokeh.")
+	squeeze := flag.Float64("squeeze", 1, "Sets the anamorphic squeeze of the lens, requires blur.")
+	catsEye := flag.Float64("catseye", 0, "Sets how far the lens barrel vignettes the aperture in the corners, requires blur.")
+	focal := flag.Float64("focal", 0, "Uses a physical camera with this focal length in mm.")
+	sensor := flag.String("sensor", "36x24", "Sets the sensor size in mm, requires focal or lens.")
+	fstop := flag.Float64("fstop", 8, "Sets the f-number, requires focal.")
+	shutter := flag.Duration("shutter", 10*time.Millisecond, "Sets how long the shutter is open, requires focal or lens.")
+	iso := flag.Float64("iso", 100, "Sets the ISO sensitivity, requires focal or lens.")
+	lensFile := flag.String("lens", "", "Uses a realistic camera that traces the lens prescription in this file.")
+	stereo := flag.String("stereo", "", "Renders both eyes side by side (sbs) or top and bottom (tb), omni-directional with an equirectangular pano.")
+	interocular := flag.Float64("iod", 0.064, "Sets the distance between the eyes, requires stereo.")
+	convergence := flag.Float64("converge", 0, "Sets the distance the eyes converge at, 0 for parallel eyes, requires stereo.")
 	depth := flag.Uint("depth", 50, "Sets how many times a ray can bounce.")
+	bvh := flag.Bool("bvh", true, "Puts the objects into a bounding volume hierarchy.")
+	tileSize := flag.Uint("tile", 16, "Sets the size of the tiles the image is split into.")
+	tileOrder := flag.String("order", "hilbert", "Sets the tile order: scanline, hilbert or spiral.")
+	progressive := flag.Bool("progressive", false, "Renders one sample per pixel per pass and saves snapshots.")
+	passes := flag.Uint("passes", 0, "Saves a snapshot every n passes, requires progressive.")
+	interval := flag.Duration("interval", 0, "Saves a snapshot every interval, requires progressive.")
+	adaptive := flag.Bool("adaptive", false, "Keeps sampling pixels until their error is below the threshold.")
+	minSamples := flag.Uint("min", 16, "Sets the minimum samples per pixel, requires adaptive.")
+	maxSamples := flag.Uint("max", 1024, "Sets the maximum samples per pixel, requires adaptive.")
+	threshold := flag.Float64("threshold", 0.02, "Sets the relative error a pixel has to reach, requires adaptive.")
+	aovList := flag.String("aov", "", "Also renders a comma separated list of aovs: depth, normal, albedo, material, object, direct, indirect or all.")
+	counts := flag.Bool("counts", false, "Also saves an image of the samples taken per pixel.")
+	checkpoint := flag.Duration("checkpoint", 0, "Saves a checkpoint of the render every interval.")
+	resume := flag.Bool("resume", false, "Continues the render from its checkpoint.")
+	seed := flag.Int64("seed", 0, "Seeds the random numbers, the same seed produces the same image.")
+	compression := flag.String("compression", "zip", "Sets the compression of exr files: none or zip.")
+	toneMap := flag.String("tonemap", "clip", "Sets the tone mapping operator: clip, reinhard, extended, hable or aces.")
+	exposure := flag.Float64("exposure", 0, "Scales the image by 2^exposure before tone mapping.")
+	white := flag.Float64("white", 1, "Sets the radiance that maps to white, requires the extended tone mapping.")
+	filter := flag.String("filter", "box", "Sets the pixel filter: box, tent, gaussian, mitchell or lanczos.")
+	radius := flag.Float64("radius", 0, "Sets the radius of the pixel filter in pixels, 0 uses the filter's default.")
+	samplerName := flag.String("sampler", "independent", "Sets the sampler: independent, stratified, halton or sobol.")
+	crop := flag.String("crop", "", "Only renders the window x0,y0,x1,y1 in pixels from the top left, or in percent of the image size with a % suffix.")
+	composite := flag.String("composite", "", "Pastes the crop window into this existing image instead of saving the window alone.")
+	frames := flag.Uint("frames", 0, "Renders this many frames of the camera animation of the key lines, numbering the images.")
+	fps := flag.Float64("fps", 24, "Sets the frames per second of the animation, requires frames.")
+	angle := flag.Float64("angle", 180, "Sets the shutter angle of the frames in degrees, requires frames.")
+	budget := flag.Duration("time", 0, "Stops the render after this long and saves what it has, 0 renders until done.")
+	denoise := flag.Bool("denoise", false, "Removes the noise from the image, guided by its normals, albedo and depth.")
 	flag.Parse()
 
+	order, err := base.ParseTileOrder(*tileOrder)
+	if err != nil {
+		log.Fatal(err)
+	}
+	spp := int(*aa * *aa)
+	if *adaptive {
+		// Every pixel takes the minimum samples, so the stratified sampler
+		// covers its strata with them and the samples after are random.
+		spp = int(*minSamples)
+	}
+	sampler, err := sampling.NewSampler(*samplerName, *seed, spp)
+	if err != nil {
+		log.Fatal(err)
+	}
+	output := filepath.Join("output", *filename)
+	sceneOptions := []func(*base.Scene){base.WithTiles(int(*tileSize), order),
+		base.WithSampler(sampler)}
+	if *bvh {
+		sceneOptions = append(sceneOptions, base.WithBVH())
+	}
+	if *adaptive {
+		sceneOptions = append(sceneOptions,
+			base.WithAdaptive(int(*minSamples), int(*maxSamples), *threshold))
+	}
+	if *aovList != "" {
+		aovs, err := base.ParseAOVs(*aovList)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sceneOptions = append(sceneOptions, base.WithAOVs(aovs...))
+	}
+	if *denoise {
+		sceneOptions = append(sceneOptions, base.WithDenoiser(postprocess.NewDenoiser(5)))
+	}
+	// saving returns the scene options with the snapshots and the checkpoint
+	// of the image saved at path, which differs for every frame, and a
+	// progress bar of its own.
+	saving := func(path string) []func(*base.Scene) {
+		options := append([]func(*base.Scene){}, sceneOptions...)
+		options = append(options, base.WithProgress(progressBar(os.Stderr)))
+		if *progressive {
+			options = append(options, base.WithProgressive(int(*passes), *interval,
+				func(film *base.Film) error { return film.Save(path) }))
+		}
+		if *checkpoint > 0 {
+			options = append(options, base.WithCheckpoint(path+".checkpoint", *checkpoint))
+		}
+		if *resume {
+			options = append(options, base.WithResume(path+".checkpoint"))
+		}
+		return options
+	}
+
 	opts.SetVFOV(*vfov)
 	opts.SetAperture(*aperture)
 	opts.SetFOVCam(*fovcam)
+	opts.SetOrthographic(*ortho)
+	opts.SetPanorama(*pano, *panoFOV)
 	opts.SetDistFocus(*distFocus)
 	opts.SetDimensions(int(*x), int(*y))
 	opts.SetAntialiasing(int(*aa))
+	operator, err := postprocess.ParseOperator(*toneMap, *white)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var physical *base.PhysicalCamera
+	if *focal > 0 || *lensFile != "" {
+		physical = &base.PhysicalCamera{FocalLength: *focal, FStop: *fstop,
+			ShutterClose: shutter.Seconds(), ISO: *iso}
+		if _, err := fmt.Sscanf(*sensor, "%gx%g", &physical.SensorWidth, &physical.SensorHeight); err != nil {
+			log.Fatalf("sensor %q is not WxH: %v", *sensor, err)
+		}
+		if *lensFile != "" {
+			if physical.Lens, err = base.LoadLens(*lensFile); err != nil {
+				log.Fatal(err)
+			}
+			physical.FocalLength = physical.Lens.FocalLength()
+			physical.FStop = physical.Lens.FStop()
+		}
+		*exposure += physical.Exposure()
+		opts.SetPhysical(physical)
+	}
+	opts.SetToneMapping(postprocess.NewToneMapping(operator, *exposure))
+	var stereoLayout base.StereoLayout
+	if *stereo != "" {
+		if stereoLayout, err = base.ParseStereoLayout(*stereo); err != nil {
+			log.Fatal(err)
+		}
+		opts.SetStereo(stereoLayout)
+	}
 	if *input != "" {
-		parsers.ParseFile(*input, opts)
+		if err := parsers.ParseFile(*input, opts); err != nil {
+			log.Fatal(err)
+		}
+	}
+	exrCompression, err := base.ParseEXRCompression(*compression)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts.GetFilm().SetCompression(exrCompression)
+	pixelFilter, err := filters.Parse(*filter, *radius)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts.GetFilm().SetFilter(pixelFilter)
+	if *crop != "" {
+		window, err := base.ParseCropWindow(*crop, opts.GetFilm().Width(), opts.GetFilm().Height())
+		if err != nil {
+			log.Fatal(err)
+		}
+		sceneOptions = append(sceneOptions, base.WithCropWindow(window))
+	}
+	if *composite != "" {
+		sceneOptions = append(sceneOptions, base.WithComposite(*composite))
 	}
 
+	var shape base.Aperture
+	if blades, err := strconv.Atoi(*bokeh); err == nil {
+		shape = base.NewPolygonAperture(blades, *bokehRotation)
+	} else if *bokeh != "" {
+		if shape, err = base.LoadMaskAperture(*bokeh); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// setLens applies the lens flags to thin lens cameras.
+	setLens := func(camera base.ThinLens) {
+		if *blur {
+			camera.ToggleBlur()
+		}
+		camera.SetAperture(shape)
+		camera.SetAnamorphic(*squeeze)
+		camera.SetCatsEye(*catsEye)
+	}
+
+	// Interrupting the render or running out of time saves the image so far.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *budget > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *budget)
+		defer cancel()
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		cancel()
+	}()
+
 	if *random {
+		if *frames > 0 {
+			log.Fatal("frames need a scene file with key lines")
+		}
 		origin := primitives.NewVec3(13, 2, 3)
 		lookat := primitives.NewVec3(0.0, 0.0, 0.0)
 		vertical := primitives.NewVec3(0.0, 1.0, 0.0)
 		distToFocus := 10.0
 		aperature := 0.1
-		camera := base.NewCameraFOV(origin, lookat, vertical, *vfov,
-			float64(*x)/float64(*y), aperature, distToFocus, 0, 1)
-		world := randomScene()
+		// Every eye of a stereo rig gets half of the image.
+		aspect := float64(*x) / float64(*y)
+		if *stereo != "" {
+			aspect = stereoLayout.EyeAspect(aspect)
+		}
+		lens := base.NewCameraFOV(origin, lookat, vertical, *vfov, aspect,
+			aperature, distToFocus, 0, 1)
+		if physical != nil {
+			physical.FocusDistance = distToFocus
+			lens = physical.Camera(origin, lookat, vertical, aspect)
+		}
+		setLens(lens)
+		var camera base.CameraModel = lens
+		if physical != nil && physical.Lens != nil {
+			if camera, err = physical.Realistic(origin, lookat, vertical, aspect); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *ortho > 0 {
+			camera = base.NewCameraOrthographic(origin, lookat, vertical, *ortho,
+				*ortho*float64(*y)/float64(*x), 0, 1)
+		}
+		if *pano != "" {
+			if camera, err = base.NewPanoramicCamera(*pano, origin, lookat, vertical,
+				*panoFOV, float64(*x)/float64(*y), 0, 1); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *stereo != "" {
+			camera = stereoRig(camera, stereoLayout, *interocular, *convergence)
+		}
+		world := randomScene(rand.New(rand.NewSource(*seed)))
 		film := opts.GetFilm()
-		if *blur {
-			camera.ToggleBlur()
+		sceneOptions = append(sceneOptions, base.WithBackground(base.SkyBackground))
+		scene := base.NewScene(camera, film, world, nil, int(*aa), int(*depth),
+			saving(output)...)
+		render(ctx, scene, output, *counts)
+		return
+	}
+
+	if camera, ok := opts.GetCamera().(base.ThinLens); ok {
+		setLens(camera)
+	}
+
+	camera := opts.GetCamera()
+	if *stereo != "" {
+		camera = stereoRig(camera, stereoLayout, *interocular, *convergence)
+	}
+	newScene := func(camera base.CameraModel, path string) *base.Scene {
+		return base.NewScene(camera, opts.GetFilm(), opts.GetWorld(),
+			opts.GetLights(), opts.GetAntialiasing(), int(*depth), saving(path)...)
+	}
+	if *frames > 0 {
+		animated, ok := camera.(*base.AnimatedCamera)
+		if !ok {
+			log.Fatal("frames need a camera animated with key lines")
 		}
-		scene := base.NewScene(camera, film, world, nil, int(*aa), int(*depth))
-		scene.Render(*filename, true)
+		animate(ctx, animated, newScene, output, *counts, int(*frames), *fps, *angle)
 		return
 	}
+	render(ctx, newScene(camera, output), output, *counts)
+}
 
-	if *blur {
-		opts.GetCamera().ToggleBlur()
+// animate renders frames of the animation of camera, fps frames a second
+// from its first keyframe with the shutter open for angle degrees of every
+// frame, and saves them at path numbered from 0. Every frame gets the scene
+// newScene returns for its own path, so it keeps its own snapshots and
+// checkpoint. A stopped render ends the animation.
+func animate(ctx context.Context, camera *base.AnimatedCamera, newScene func(base.CameraModel, string) *base.Scene, path string, counts bool, frames int, fps, angle float64) {
+	start, _ := camera.Span()
+	ext := filepath.Ext(path)
+	for i := 0; i < frames && ctx.Err() == nil; i++ {
+		t := start + float64(i)/fps
+		framePath := fmt.Sprintf("%s_%04d%s", strings.TrimSuffix(path, ext), i, ext)
+		render(ctx, newScene(camera.Frame(t, t+angle/360/fps), framePath), framePath, counts)
 	}
+}
 
-	scene := base.NewScene(opts.GetCamera(), opts.GetFilm(), opts.GetWorld(),
-		opts.GetLights(), opts.GetAntialiasing(), int(*depth))
-	scene.Render(*filename, *random)
+// stereoRig returns the stereo rig of camera with the given layout.
+func stereoRig(camera base.CameraModel, layout base.StereoLayout, interocular, convergence float64) base.CameraModel {
+	rig, err := base.NewStereoRig(camera, interocular, convergence, layout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return rig
+}
+
+// render renders the scene and saves the image at path together with its
+// AOVs and, if counts is set, the image of the samples taken per pixel. A
+// render stopped by ctx is saved as far as it got.
+func render(ctx context.Context, scene *base.Scene, path string, counts bool) {
+	film, _, err := scene.Render(ctx)
+	if film == nil {
+		log.Fatal(err)
+	}
+	if err != nil && err == ctx.Err() {
+		// The progress bar of a stopped render does not end its line.
+		fmt.Fprintln(os.Stderr)
+		log.Println("render stopped:", err)
+	} else if err != nil {
+		log.Println(err)
+	}
+	if err := film.Save(path); err != nil {
+		log.Fatal(err)
+	}
+	if err := scene.SaveAOVs(path); err != nil {
+		log.Fatal(err)
+	}
+	if counts {
+		ext := filepath.Ext(path)
+		if err := scene.SampleCounts().Save(strings.TrimSuffix(path, ext) + "_samples" + ext); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Fprintln(os.Stderr, scene.Stats())
 }
@@ -3,6 +3,7 @@ package materials
 import (
 	"math"
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"raytracer/textures"
 )
 
@@ -22,15 +23,35 @@ func NewBlinnphong(ambient, diffuse, specular, reflective textures.Color, phong
 	return Blinnphong{ambient, diffuse, specular, reflective, phong, ambientLight}
 }
 
-// Scatter calculates the incidental reflected ray if there is a reflection.
-func (b Blinnphong) Scatter(rayIn *primitives.Ray, attenuation *textures.Color, rec *HitRecord, depth int, light Light, shadow bool) (bool, *primitives.Ray) {
-	if light != nil {
-		attenuation.Update(b.shade(rayIn, rec, depth, light, shadow))
-	}
+// Sample reflects the ray in the mirror direction if the material is
+// reflective.
+func (b Blinnphong) Sample(rayIn *primitives.Ray, rec *HitRecord, srec *ScatterRecord, sampler sampling.Sampler) bool {
 	reflected := rayIn.Direction().Normalize().Reflect(rec.Normal())
-	scattered := primitives.NewRay(rec.Point(), reflected)
+	scattered := primitives.NewRay(rec.Point(), reflected, primitives.WithTime(rayIn.Time()))
+	srec.UpdateRecord(scattered, b.reflective, 0, true)
 	rec.SetReflective(b.reflective)
-	return scattered.Direction().Dot(rec.normal) > 0 && b.reflective.NotBlack(), scattered
+	return scattered.Direction().Dot(rec.normal) > 0 && b.reflective.NotBlack()
+}
+
+// Eval returns the diffuse and specular response to light arriving from
+// direction.
+func (b Blinnphong) Eval(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) textures.Color {
+	n := rec.normal
+	l := direction
+	color := b.diffuse.MultiplyScalar(math.Max(0, n.Dot(l)))
+
+	v := rayIn.Direction().MultiplyScalar(-1).Normalize()
+	r := n.MultiplyScalar(2 * l.Dot(n)).Subtract(l)
+	rbv := r.Dot(v)
+	if rbv < 0 {
+		return color
+	}
+	return color.Add(b.specular.MultiplyScalar(math.Pow(rbv, b.phong)))
+}
+
+// PDF is zero since the diffuse and specular lobes are never sampled.
+func (b Blinnphong) PDF(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) float64 {
+	return 0
 }
 
 // Emitted is defined to implement the material interface.
@@ -38,38 +59,9 @@ func (b Blinnphong) Emitted(u, v float64, p primitives.Vec3) textures.Color {
 	return textures.Black
 }
 
-func (b Blinnphong) shade(rayIn *primitives.Ray, rec *HitRecord, depth int, light Light, shadow bool) textures.Color {
-	color := textures.Black
-	if !shadow {
-		n := rec.normal
-		l := light.LVec(rec.Point())
-		intensity := light.Intensity()
-		distance := light.Direction(rec.Point()).Magnitude()
-		if light.Falloff() == 1 {
-			intensity = intensity.DivideScalar(distance)
-		} else if light.Falloff() == 2 {
-			intensity = intensity.DivideScalar(distance * distance)
-		}
-		color = color.Add(b.diffuse.Multiply(intensity).
-			MultiplyScalar(math.Max(0, n.Dot(l))))
-
-		v := rayIn.Origin().Subtract(rec.Point()).Normalize()
-		lh := l.MultiplyScalar(-1)
-		rh := n.MultiplyScalar(2 * l.Dot(n))
-		r := rh.Add(lh)
-
-		if r.Dot(v)/(r.Magnitude()*v.Magnitude()) < 0 {
-			return color
-		}
-
-		rbv := r.Dot(v)
-		rbv = math.Pow(rbv, b.phong)
-
-		color = color.Add(b.specular.Multiply(intensity).
-			MultiplyScalar(rbv))
-
-	}
-	return color
+// Albedo ...
+func (b Blinnphong) Albedo(rec *HitRecord) textures.Color {
+	return b.diffuse
 }
 
 // GetAmbient ...
@@ -2,8 +2,8 @@ package materials
 
 import (
 	"math"
-	"math/rand"
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"raytracer/textures"
 	"raytracer/utils"
 )
@@ -18,12 +18,11 @@ func NewDielectric(reflectIdx float64) Dielectric {
 	return Dielectric{reflectIdx}
 }
 
-// Scatter calculates the incidental reflected/refracted ray if there is a
+// Sample calculates the incidental reflected/refracted ray if there is a
 // reflection/refraction.
-func (d Dielectric) Scatter(rayIn *primitives.Ray, attenuation *textures.Color, rec *HitRecord, depth int, light Light, shadow bool) (bool, *primitives.Ray) {
+func (d Dielectric) Sample(rayIn *primitives.Ray, rec *HitRecord, srec *ScatterRecord, sampler sampling.Sampler) bool {
 	var outwardNormal primitives.Vec3
 	var niOverNt, cosine, refractProb float64
-	attenuation.Update(textures.White)
 	if rayIn.Direction().Dot(rec.Normal()) > 0 {
 		outwardNormal = rec.Normal().MultiplyScalar(-1)
 		niOverNt = d.reflectIdx
@@ -40,11 +39,25 @@ func (d Dielectric) Scatter(rayIn *primitives.Ray, attenuation *textures.Color,
 	} else {
 		refractProb = 1.0
 	}
-	if rand.Float64() < refractProb {
+	if sampler.Get1D() < refractProb {
 		reflected := rayIn.Direction().Reflect(rec.Normal())
-		return true, primitives.NewRay(rec.Point(), reflected)
+		srec.UpdateRecord(primitives.NewRay(rec.Point(), reflected,
+			primitives.WithTime(rayIn.Time())), textures.White, 0, true)
+		return true
 	}
-	return true, primitives.NewRay(rec.Point(), refVec)
+	srec.UpdateRecord(primitives.NewRay(rec.Point(), refVec,
+		primitives.WithTime(rayIn.Time())), textures.White, 0, true)
+	return true
+}
+
+// Eval is black since glass only transmits light along the sampled direction.
+func (d Dielectric) Eval(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) textures.Color {
+	return textures.Black
+}
+
+// PDF is zero since glass only scatters along delta directions.
+func (d Dielectric) PDF(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) float64 {
+	return 0
 }
 
 // Emitted is defined to implement the material interface.
@@ -52,6 +65,11 @@ func (d Dielectric) Emitted(u, v float64, p primitives.Vec3) textures.Color {
 	return textures.Black
 }
 
+// Albedo is white since glass does not absorb light.
+func (d Dielectric) Albedo(rec *HitRecord) textures.Color {
+	return textures.White
+}
+
 // GetAmbient ...
 func (d Dielectric) GetAmbient() textures.Color {
 	return textures.Black
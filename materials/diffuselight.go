@@ -2,8 +2,8 @@ package materials
 
 import (
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"raytracer/textures"
-	"raytracer/utils"
 )
 
 // DiffuseLight is the material used to make an area light.
@@ -16,12 +16,19 @@ func NewDiffuseLight(emit textures.Texture) DiffuseLight {
 	return DiffuseLight{emit}
 }
 
-// Scatter randomly bounces the ray to give a fairly accurate representation of
-// the diffuse effect.
-func (d DiffuseLight) Scatter(rayIn *primitives.Ray, attenuation *textures.Color, rec *HitRecord, depth int, light Light, shadow bool) (bool, *primitives.Ray) {
-	// attenuation.Update(l.albedo.GetColor(0, 0, rec.Point()))
-	target := rec.Point().Add(rec.Normal()).Add(utils.RandomInUnitSphere())
-	return true, primitives.NewRay(rec.Point(), target.Subtract(rec.Point()))
+// Sample always terminates the path since lights only emit.
+func (d DiffuseLight) Sample(rayIn *primitives.Ray, rec *HitRecord, srec *ScatterRecord, sampler sampling.Sampler) bool {
+	return false
+}
+
+// Eval is black since lights do not reflect.
+func (d DiffuseLight) Eval(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) textures.Color {
+	return textures.Black
+}
+
+// PDF is zero since lights never scatter.
+func (d DiffuseLight) PDF(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) float64 {
+	return 0
 }
 
 // Emitted is defined to implement the material interface.
@@ -29,6 +36,11 @@ func (d DiffuseLight) Emitted(u, v float64, p primitives.Vec3) textures.Color {
 	return d.emit.GetColor(u, v, p)
 }
 
+// Albedo is the emitted color, clipped to one.
+func (d DiffuseLight) Albedo(rec *HitRecord) textures.Color {
+	return d.emit.GetColor(rec.U(), rec.V(), rec.Point()).Clip()
+}
+
 // GetAmbient ...
 func (d DiffuseLight) GetAmbient() textures.Color {
 	return textures.Black
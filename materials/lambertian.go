@@ -1,7 +1,9 @@
 package materials
 
 import (
+	"math"
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"raytracer/textures"
 	"raytracer/utils"
 )
@@ -16,12 +18,27 @@ func NewLambertian(color textures.Texture) Lambertian {
 	return Lambertian{color}
 }
 
-// Scatter randomly bounces the ray to give a fairly accurate representation of
-// the diffuse effect.
-func (l Lambertian) Scatter(rayIn *primitives.Ray, attenuation *textures.Color, rec *HitRecord, depth int, light Light, shadow bool) (bool, *primitives.Ray) {
-	attenuation.Update(l.albedo.GetColor(0, 0, rec.Point()))
-	target := rec.Point().Add(rec.Normal()).Add(utils.RandomInUnitSphere())
-	return true, primitives.NewRay(rec.Point(), target.Subtract(rec.Point()))
+// Sample bounces the ray in a cosine weighted direction around the normal,
+// which cancels the cosine term of Eval.
+func (l Lambertian) Sample(rayIn *primitives.Ray, rec *HitRecord, srec *ScatterRecord, sampler sampling.Sampler) bool {
+	direction := utils.RandomCosineDirection(rec.Normal(), sampler)
+	scattered := primitives.NewRay(rec.Point(), direction, primitives.WithTime(rayIn.Time()))
+	srec.UpdateRecord(scattered, l.albedo.GetColor(0, 0, rec.Point()),
+		l.PDF(rayIn, rec, direction), false)
+	return true
+}
+
+// Eval returns the albedo spread evenly over the hemisphere, weighted by the
+// cosine of the incoming light.
+func (l Lambertian) Eval(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) textures.Color {
+	cosine := math.Max(0, rec.Normal().Dot(direction))
+	return l.albedo.GetColor(0, 0, rec.Point()).
+		MultiplyScalar(cosine / math.Pi)
+}
+
+// PDF returns the density of the cosine weighted hemisphere.
+func (l Lambertian) PDF(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) float64 {
+	return math.Max(0, rec.Normal().Dot(direction)) / math.Pi
 }
 
 // Emitted is defined to implement the material interface.
@@ -29,6 +46,11 @@ func (l Lambertian) Emitted(u, v float64, p primitives.Vec3) textures.Color {
 	return textures.Black
 }
 
+// Albedo ...
+func (l Lambertian) Albedo(rec *HitRecord) textures.Color {
+	return l.albedo.GetColor(0, 0, rec.Point())
+}
+
 // GetAmbient ...
 func (l Lambertian) GetAmbient() textures.Color {
 	return textures.Black
@@ -1,16 +1,66 @@
 package materials
 
 import (
+	"math"
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"raytracer/textures"
 )
 
-// Light ...
+// Light is anything that can be sampled directly when computing direct
+// lighting.
 type Light interface {
-	LVec(point primitives.Vec3) primitives.Vec3
-	Direction(point primitives.Vec3) primitives.Vec3
+	// Sample picks a direction from point towards the light and stores it in
+	// ls. It returns false if the light does not illuminate point.
+	Sample(point primitives.Vec3, ls *LightSample, sampler sampling.Sampler) bool
+	// PDF returns the solid angle density with which Sample picks direction
+	// from point. Delta lights always return zero.
+	PDF(point, direction primitives.Vec3) float64
 	Intensity() textures.Color
-	Falloff() int
+}
+
+// LightSample records a direction sampled towards a light.
+type LightSample struct {
+	direction primitives.Vec3
+	distance  float64
+	radiance  textures.Color
+	pdf       float64
+	delta     bool
+}
+
+// UpdateSample modifies a light sample with new fields.
+func (ls *LightSample) UpdateSample(direction primitives.Vec3, distance float64, radiance textures.Color, pdf float64, delta bool) {
+	ls.direction = direction
+	ls.distance = distance
+	ls.radiance = radiance
+	ls.pdf = pdf
+	ls.delta = delta
+}
+
+// Direction returns the unit vector pointing towards the light.
+func (ls *LightSample) Direction() primitives.Vec3 {
+	return ls.direction
+}
+
+// Distance returns the distance to the sampled point on the light.
+func (ls *LightSample) Distance() float64 {
+	return ls.distance
+}
+
+// Radiance returns the light arriving from the sampled direction.
+func (ls *LightSample) Radiance() textures.Color {
+	return ls.radiance
+}
+
+// PDF returns the solid angle density of the sampled direction.
+func (ls *LightSample) PDF() float64 {
+	return ls.pdf
+}
+
+// Delta returns true if the light can only be reached by sampling it, such as
+// point and directional lights.
+func (ls *LightSample) Delta() bool {
+	return ls.delta
 }
 
 // AmbientLight ...
@@ -33,6 +83,16 @@ func (a *AmbientLight) Direction(point primitives.Vec3) primitives.Vec3 {
 	return primitives.Vec3{}
 }
 
+// Sample always fails since ambient light is applied through the material.
+func (a *AmbientLight) Sample(point primitives.Vec3, ls *LightSample, sampler sampling.Sampler) bool {
+	return false
+}
+
+// PDF ...
+func (a *AmbientLight) PDF(point, direction primitives.Vec3) float64 {
+	return 0
+}
+
 // Intensity ...
 func (a *AmbientLight) Intensity() textures.Color {
 	return a.color
@@ -64,6 +124,17 @@ func (d *DirectionalLight) Direction(point primitives.Vec3) primitives.Vec3 {
 	return d.location.MultiplyScalar(-1)
 }
 
+// Sample returns the direction of the light, which is infinitely far away.
+func (d *DirectionalLight) Sample(point primitives.Vec3, ls *LightSample, sampler sampling.Sampler) bool {
+	ls.UpdateSample(d.LVec(point), math.MaxFloat64, d.color, 1, true)
+	return true
+}
+
+// PDF ...
+func (d *DirectionalLight) PDF(point, direction primitives.Vec3) float64 {
+	return 0
+}
+
 // Intensity ...
 func (d *DirectionalLight) Intensity() textures.Color {
 	return d.color
@@ -96,6 +167,24 @@ func (p *PointLight) Direction(point primitives.Vec3) primitives.Vec3 {
 	return p.location.Subtract(point)
 }
 
+// Sample returns the direction of the light attenuated by its falloff.
+func (p *PointLight) Sample(point primitives.Vec3, ls *LightSample, sampler sampling.Sampler) bool {
+	intensity := p.color
+	distance := p.Direction(point).Magnitude()
+	if p.falloff == 1 {
+		intensity = intensity.DivideScalar(distance)
+	} else if p.falloff == 2 {
+		intensity = intensity.DivideScalar(distance * distance)
+	}
+	ls.UpdateSample(p.LVec(point), distance, intensity, 1, true)
+	return true
+}
+
+// PDF ...
+func (p *PointLight) PDF(point, direction primitives.Vec3) float64 {
+	return 0
+}
+
 // Intensity ...
 func (p *PointLight) Intensity() textures.Color {
 	return p.color
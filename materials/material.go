@@ -2,13 +2,25 @@ package materials
 
 import (
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"raytracer/textures"
 )
 
 // Material is a container for how our polygons interact with light. All
 // materials in the package must implement this interface.
 type Material interface {
-	Scatter(rayIn *primitives.Ray, attenuation *textures.Color, rec *HitRecord, depth int, light Light, shadow bool) (bool, *primitives.Ray)
+	// Sample picks the direction the ray continues in after hitting the
+	// surface and stores it in srec. It returns false if the path ends.
+	Sample(rayIn *primitives.Ray, rec *HitRecord, srec *ScatterRecord, sampler sampling.Sampler) bool
+	// Eval returns the light reflected back along rayIn for unit light
+	// arriving from direction, including the cosine term. Perfectly specular
+	// materials return black.
+	Eval(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) textures.Color
+	// PDF returns the solid angle density with which Sample picks direction.
+	PDF(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) float64
 	Emitted(u, v float64, p primitives.Vec3) textures.Color
+	// Albedo returns the base color of the surface, used as a guide for
+	// compositing and denoising.
+	Albedo(rec *HitRecord) textures.Color
 	GetAmbient() textures.Color
 }
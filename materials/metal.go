@@ -3,6 +3,7 @@ package materials
 import (
 	"math/rand"
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"raytracer/textures"
 	"raytracer/utils"
 )
@@ -23,21 +24,34 @@ func NewMetal(color textures.Texture, fuzz float64) Metal {
 	return Metal{color, fuzz}
 }
 
-// NewRandomMetal returns a random metal definition using Go's builtin PRNG.
-func NewRandomMetal() Metal {
-	color := textures.NewColor(0.5*(1+rand.Float64()),
-		0.5*(1+rand.Float64()), 0.5*(1+rand.Float64()))
-	fuzz := 0.5 * rand.Float64()
+// NewRandomMetal returns a random metal definition drawn from rng.
+func NewRandomMetal(rng *rand.Rand) Metal {
+	color := textures.NewColor(0.5*(1+rng.Float64()),
+		0.5*(1+rng.Float64()), 0.5*(1+rng.Float64()))
+	fuzz := 0.5 * rng.Float64()
 	return Metal{color, fuzz}
 }
 
-// Scatter calculates the incidental reflected ray if there is a reflection.
-func (m Metal) Scatter(rayIn *primitives.Ray, attenuation *textures.Color, rec *HitRecord, depth int, lights Light, shadow bool) (bool, *primitives.Ray) {
-	attenuation.Update(m.albedo.GetColor(0, 0, rec.Point()))
+// Sample calculates the incidental reflected ray if there is a reflection.
+// Fuzzy reflections are treated as specular since their distribution can not
+// be evaluated.
+func (m Metal) Sample(rayIn *primitives.Ray, rec *HitRecord, srec *ScatterRecord, sampler sampling.Sampler) bool {
 	reflected := rayIn.Direction().Normalize().Reflect(rec.Normal())
 	scattered := primitives.NewRay(rec.Point(),
-		reflected.Add(utils.RandomInUnitSphere().MultiplyScalar(m.fuzz)))
-	return scattered.Direction().Dot(rec.normal) > 0, scattered
+		reflected.Add(utils.RandomInUnitSphere(sampler).MultiplyScalar(m.fuzz)),
+		primitives.WithTime(rayIn.Time()))
+	srec.UpdateRecord(scattered, m.albedo.GetColor(0, 0, rec.Point()), 0, true)
+	return scattered.Direction().Dot(rec.normal) > 0
+}
+
+// Eval is black since metal only reflects light along the sampled direction.
+func (m Metal) Eval(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) textures.Color {
+	return textures.Black
+}
+
+// PDF is zero since metal only scatters along delta directions.
+func (m Metal) PDF(rayIn *primitives.Ray, rec *HitRecord, direction primitives.Vec3) float64 {
+	return 0
 }
 
 // Emitted is defined to implement the material interface.
@@ -45,6 +59,11 @@ func (m Metal) Emitted(u, v float64, p primitives.Vec3) textures.Color {
 	return textures.Black
 }
 
+// Albedo ...
+func (m Metal) Albedo(rec *HitRecord) textures.Color {
+	return m.albedo.GetColor(0, 0, rec.Point())
+}
+
 // GetAmbient ...
 func (m Metal) GetAmbient() textures.Color {
 	return textures.Black
@@ -12,11 +12,15 @@ type HitRecord struct {
 	p, normal  primitives.Vec3
 	reflective textures.Color
 	mat        Material
+	object     int
+	// nodes and primitives count the intersection tests made while looking
+	// for the hit. They are not copied with the record.
+	nodes, primitives int
 }
 
 // NewRecord returns a new hit record with the following information.
 func NewRecord(t, u, v float64, p, normal primitives.Vec3, mat Material) *HitRecord {
-	return &HitRecord{t, u, v, p, normal, textures.Black, mat}
+	return &HitRecord{t, u, v, p, normal, textures.Black, mat, 0, 0, 0}
 }
 
 // UpdateRecord modifies a record with new fields.
@@ -70,6 +74,41 @@ func (rec *HitRecord) Material() Material {
 	return rec.mat
 }
 
+// SetObject records the index of the hit object in the world, counting from
+// one.
+func (rec *HitRecord) SetObject(object int) {
+	rec.object = object
+}
+
+// Object returns the index of the hit object in the world, counting from one.
+// It is zero if the object is not part of an object list.
+func (rec *HitRecord) Object() int {
+	return rec.object
+}
+
+// CountNode counts an intersection test with a node of an acceleration
+// structure.
+func (rec *HitRecord) CountNode() {
+	rec.nodes++
+}
+
+// CountPrimitive counts an intersection test with a shape.
+func (rec *HitRecord) CountPrimitive() {
+	rec.primitives++
+}
+
+// AddCounts adds the intersection tests counted in rec2 to the record.
+func (rec *HitRecord) AddCounts(rec2 *HitRecord) {
+	rec.nodes += rec2.nodes
+	rec.primitives += rec2.primitives
+}
+
+// Counts returns the number of node and shape intersection tests made while
+// looking for the hit.
+func (rec *HitRecord) Counts() (int, int) {
+	return rec.nodes, rec.primitives
+}
+
 // CopyRecord update the current record with the fields another record.
 func (rec *HitRecord) CopyRecord(rec2 *HitRecord) {
 	rec.t = rec2.t
@@ -78,4 +117,45 @@ func (rec *HitRecord) CopyRecord(rec2 *HitRecord) {
 	rec.p = rec2.p
 	rec.normal = rec2.normal
 	rec.mat = rec2.mat
+	rec.object = rec2.object
+}
+
+// ScatterRecord records the direction a material sampled after a hit.
+// Attenuation is the throughput weight of the bounce, i.e. the value of Eval
+// divided by the pdf of the sampled direction.
+type ScatterRecord struct {
+	ray         *primitives.Ray
+	attenuation textures.Color
+	pdf         float64
+	specular    bool
+}
+
+// UpdateRecord modifies a scatter record with new fields.
+func (srec *ScatterRecord) UpdateRecord(ray *primitives.Ray, attenuation textures.Color, pdf float64, specular bool) {
+	srec.ray = ray
+	srec.attenuation = attenuation
+	srec.pdf = pdf
+	srec.specular = specular
+}
+
+// Ray returns the scattered ray.
+func (srec *ScatterRecord) Ray() *primitives.Ray {
+	return srec.ray
+}
+
+// Attenuation returns the throughput weight of the scattered ray.
+func (srec *ScatterRecord) Attenuation() textures.Color {
+	return srec.attenuation
+}
+
+// PDF returns the solid angle density of the scattered direction. It is only
+// meaningful when the scattered direction is not specular.
+func (srec *ScatterRecord) PDF() float64 {
+	return srec.pdf
+}
+
+// Specular returns true if the direction was picked from a delta
+// distribution that can not be evaluated with Eval.
+func (srec *ScatterRecord) Specular() bool {
+	return srec.specular
 }
@@ -0,0 +1,105 @@
+package objects
+
+import (
+	"raytracer/materials"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"raytracer/textures"
+)
+
+// Sampleable is implemented by shapes that can pick points on their surface,
+// which allows emissive shapes to be sampled directly as area lights.
+type Sampleable interface {
+	Object
+	// Sample stores a point on the shape as seen from origin in rec and
+	// returns the solid angle density of picking it, or zero on failure.
+	Sample(origin primitives.Vec3, rec *materials.HitRecord, sampler sampling.Sampler) float64
+	// PDF returns the solid angle density with which Sample picks the point
+	// hit by the ray leaving origin along direction.
+	PDF(origin, direction primitives.Vec3) float64
+	// Material returns the material of the shape.
+	Material() materials.Material
+}
+
+// AreaLight turns an emissive shape into a light that can be sampled for
+// direct lighting.
+type AreaLight struct {
+	shape Sampleable
+}
+
+// NewAreaLight returns a new area light that emits from the surface of shape.
+func NewAreaLight(shape Sampleable) *AreaLight {
+	return &AreaLight{shape}
+}
+
+// Sample picks a point on the shape and returns the light it emits towards
+// point.
+func (a *AreaLight) Sample(point primitives.Vec3, ls *materials.LightSample, sampler sampling.Sampler) bool {
+	var rec materials.HitRecord
+	pdf := a.shape.Sample(point, &rec, sampler)
+	if pdf <= 0 {
+		return false
+	}
+	toLight := rec.Point().Subtract(point)
+	distance := toLight.Magnitude()
+	if distance == 0 {
+		return false
+	}
+	radiance := rec.Material().Emitted(rec.U(), rec.V(), rec.Point())
+	ls.UpdateSample(toLight.DivideScalar(distance), distance, radiance, pdf, false)
+	return true
+}
+
+// PDF ...
+func (a *AreaLight) PDF(point, direction primitives.Vec3) float64 {
+	return a.shape.PDF(point, direction)
+}
+
+// Intensity returns the emission of the shape at the texture origin.
+func (a *AreaLight) Intensity() textures.Color {
+	return a.shape.Material().Emitted(0, 0, primitives.NewVec3(0, 0, 0))
+}
+
+// CollectLights walks the object hierarchy and returns an area light for
+// every sampleable shape with an emissive material.
+func CollectLights(obj Object) []materials.Light {
+	var lights []materials.Light
+	switch o := obj.(type) {
+	case *ObjectList:
+		for _, v := range o.objects {
+			lights = append(lights, CollectLights(v)...)
+		}
+	case *BVHNode:
+		lights = append(lights, CollectLights(o.left)...)
+		if o.right != o.left {
+			lights = append(lights, CollectLights(o.right)...)
+		}
+	case *indexedObject:
+		lights = append(lights, CollectLights(o.Object)...)
+	case Sampleable:
+		if _, ok := o.Material().(materials.DiffuseLight); ok {
+			lights = append(lights, NewAreaLight(o))
+		}
+	}
+	return lights
+}
+
+// LightsByObject returns the area lights of CollectLights keyed by the index
+// of the object of world they belong to, as hits report it. A world that is
+// not an object list is a single object with index zero.
+func LightsByObject(world Object) map[int][]materials.Light {
+	lights := make(map[int][]materials.Light)
+	list, ok := world.(*ObjectList)
+	if !ok {
+		if l := CollectLights(world); len(l) > 0 {
+			lights[0] = l
+		}
+		return lights
+	}
+	for i, v := range list.objects {
+		if l := CollectLights(v); len(l) > 0 {
+			lights[i+1] = l
+		}
+	}
+	return lights
+}
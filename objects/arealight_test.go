@@ -0,0 +1,54 @@
+package objects
+
+import (
+	"math"
+	"raytracer/materials"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"raytracer/textures"
+	"testing"
+)
+
+func TestSampleMatchesPDF(t *testing.T) {
+	light := materials.NewDiffuseLight(textures.White)
+	shapes := []Sampleable{
+		NewSphere(primitives.NewVec3(0, 5, 0), 1, light),
+		NewRectangleXY(-1, 1, -1, 1, -3, light),
+	}
+	origin := primitives.NewVec3(0.2, 0.1, 0.3)
+	sampler := sampling.NewIndependent(1)
+	for _, shape := range shapes {
+		for i := 0; i < 100; i++ {
+			var rec materials.HitRecord
+			sampler.StartSample(0, 0, i)
+			pdf := shape.Sample(origin, &rec, sampler)
+			if pdf <= 0 {
+				t.Fatalf("%T: expected a positive pdf, got %f", shape, pdf)
+			}
+			direction := rec.Point().Subtract(origin).Normalize()
+			if got := shape.PDF(origin, direction); math.Abs(got-pdf) > 1e-6*pdf {
+				t.Errorf("%T: Sample pdf %f != PDF %f", shape, pdf, got)
+			}
+		}
+	}
+}
+
+func TestCollectLights(t *testing.T) {
+	world := NewEmptyObjectList(3)
+	world.Add(NewSphere(primitives.NewVec3(0, 0, 0), 1,
+		materials.NewLambertian(textures.White)))
+	world.Add(NewSphere(primitives.NewVec3(0, 5, 0), 1,
+		materials.NewDiffuseLight(textures.White)))
+	world.Add(NewRectangleXY(-1, 1, -1, 1, -3,
+		materials.NewDiffuseLight(textures.White)))
+	if lights := CollectLights(world); len(lights) != 2 {
+		t.Errorf("expected 2 lights, got %d", len(lights))
+	}
+	lights := LightsByObject(world)
+	if len(lights) != 2 || len(lights[2]) != 1 || len(lights[3]) != 1 {
+		t.Errorf("expected a light for objects 2 and 3, got %v", lights)
+	}
+	if lights := LightsByObject(world.List()[1]); len(lights[0]) != 1 {
+		t.Errorf("expected a light for the single object, got %v", lights)
+	}
+}
@@ -108,13 +108,51 @@ func NewEmptyBVHNode() *BVHNode {
 	return &BVHNode{}
 }
 
+// NewBVH returns a BVH over the objects of world, or world itself if it is not
+// an object list with at least two objects that all have bounding boxes. Hits
+// report the index of the object in the list like the list does. t0 and t1
+// bound the times of the rays.
+func NewBVH(world Object, t0, t1 float64) Object {
+	list, ok := world.(*ObjectList)
+	if !ok || len(list.objects) < 2 {
+		return world
+	}
+	leaves := make([]Object, len(list.objects))
+	for i, v := range list.objects {
+		if ok, _ := v.BoundingBox(t0, t1); !ok {
+			return world
+		}
+		leaves[i] = &indexedObject{v, i + 1}
+	}
+	return NewBVHNode(leaves, len(leaves), t0, t1)
+}
+
+// indexedObject is an object of a list placed in a BVH, which remembers its
+// index in the list.
+type indexedObject struct {
+	Object
+	index int
+}
+
+// Hit records the index of the object when it is hit.
+func (o *indexedObject) Hit(r *primitives.Ray, tMin, tMax float64, rec *materials.HitRecord) bool {
+	if !o.Object.Hit(r, tMin, tMax, rec) {
+		return false
+	}
+	rec.SetObject(o.index)
+	return true
+}
+
 // Hit ...
 func (n *BVHNode) Hit(r *primitives.Ray, tMin, tMax float64, rec *materials.HitRecord) bool {
+	rec.CountNode()
 	if n.box.Hit(r, tMin, tMax, rec) {
 		leftRec := materials.HitRecord{}
 		rightRec := materials.HitRecord{}
 		leftHit := n.left.Hit(r, tMin, tMax, &leftRec)
 		rightHit := n.right.Hit(r, tMin, tMax, &rightRec)
+		rec.AddCounts(&leftRec)
+		rec.AddCounts(&rightRec)
 		if leftHit && rightHit {
 			if leftRec.T() < rightRec.T() {
 				rec.CopyRecord(&leftRec)
@@ -28,6 +28,7 @@ func (s *MovingSphere) center(time float64) primitives.Vec3 {
 // Hit returns true if a ray intersects with the sphere and stores the result in
 // the passed record.
 func (s *MovingSphere) Hit(r *primitives.Ray, tMin, tMax float64, rec *materials.HitRecord) bool {
+	rec.CountPrimitive()
 	oc := r.Origin().Subtract(s.center(r.Time()))
 	a := r.Direction().Dot(r.Direction())
 	b := 2 * oc.Dot(r.Direction())
@@ -63,3 +64,8 @@ func (s *MovingSphere) BoundingBox(t0, t1 float64) (bool, *AABB) {
 	box := SurroundingBox(box0, box1)
 	return true, box
 }
+
+// Material returns the material of the sphere.
+func (s *MovingSphere) Material() materials.Material {
+	return s.mat
+}
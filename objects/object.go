@@ -10,3 +10,34 @@ type Object interface {
 	Hit(r *primitives.Ray, tMin, tMax float64, rec *materials.HitRecord) bool
 	BoundingBox(t0, t1 float64) (bool, *AABB)
 }
+
+// CollectMaterials walks the object hierarchy and returns the distinct
+// materials of its shapes in the order they are first found. Materials are
+// compared by value, so shapes created with equal materials share one.
+func CollectMaterials(obj Object) []materials.Material {
+	var mats []materials.Material
+	seen := make(map[materials.Material]bool)
+	var walk func(obj Object)
+	walk = func(obj Object) {
+		switch o := obj.(type) {
+		case *ObjectList:
+			for _, v := range o.objects {
+				walk(v)
+			}
+		case *BVHNode:
+			walk(o.left)
+			if o.right != o.left {
+				walk(o.right)
+			}
+		case *indexedObject:
+			walk(o.Object)
+		case interface{ Material() materials.Material }:
+			if m := o.Material(); m != nil && !seen[m] {
+				seen[m] = true
+				mats = append(mats, m)
+			}
+		}
+	}
+	walk(obj)
+	return mats
+}
@@ -37,18 +37,21 @@ func (o *ObjectList) List() []Object {
 }
 
 // Hit for an ObjectList iterates through the objects inside the list and puts
-// into the record the first object that would be hit.
+// into the record the first object that would be hit, along with its index in
+// the list. With nested lists the index is the one in the outermost list.
 func (o *ObjectList) Hit(r *primitives.Ray, tMin, tMax float64, rec *materials.HitRecord) bool {
 	hit := false
 	tempRec := materials.HitRecord{}
 	closestSoFar := tMax
-	for _, v := range o.objects {
+	for i, v := range o.objects {
 		if v.Hit(r, tMin, closestSoFar, &tempRec) {
 			hit = true
 			closestSoFar = tempRec.T()
+			tempRec.SetObject(i + 1)
 			rec.CopyRecord(&tempRec)
 		}
 	}
+	rec.AddCounts(&tempRec)
 	return hit
 }
 
@@ -1,8 +1,10 @@
 package objects
 
 import (
+	"math"
 	"raytracer/materials"
 	"raytracer/primitives"
+	"raytracer/sampling"
 )
 
 // RectangleXY ...
@@ -25,6 +27,7 @@ func NewRectangleXY(x0, x1, y0, y1, o float64, mat materials.Material) *Rectangl
 
 // Hit ...
 func (rect *RectangleXY) Hit(r *primitives.Ray, tMin, tMax float64, rec *materials.HitRecord) bool {
+	rec.CountPrimitive()
 	t := (rect.o - r.Origin().Z()) / r.Direction().Z()
 	if t < tMin || t > tMax {
 		return false
@@ -46,3 +49,32 @@ func (rect *RectangleXY) BoundingBox(t0, t1 float64) (bool, *AABB) {
 	return true, NewAABB(primitives.NewVec3(rect.x0, rect.y0, rect.o-0.0001),
 		primitives.NewVec3(rect.x1, rect.y1, rect.o+0.0001))
 }
+
+// Material returns the material of the rectangle.
+func (rect *RectangleXY) Material() materials.Material {
+	return rect.mat
+}
+
+// Area returns the area of the rectangle.
+func (rect *RectangleXY) Area() float64 {
+	return (rect.x1 - rect.x0) * (rect.y1 - rect.y0)
+}
+
+// Sample stores a point distributed uniformly over the rectangle in rec and
+// returns the solid angle density of picking it as seen from origin.
+func (rect *RectangleXY) Sample(origin primitives.Vec3, rec *materials.HitRecord, sampler sampling.Sampler) float64 {
+	u, v := sampler.Get2D()
+	p := primitives.NewVec3(rect.x0+u*(rect.x1-rect.x0), rect.y0+v*(rect.y1-rect.y0), rect.o)
+	rec.UpdateRecord(0, u, v, p, primitives.UnitZ, rect.mat)
+	return areaToSolidAngle(1/rect.Area(), origin, p, primitives.UnitZ)
+}
+
+// PDF returns the density with which Sample picks the point the ray from
+// origin along direction hits.
+func (rect *RectangleXY) PDF(origin, direction primitives.Vec3) float64 {
+	var rec materials.HitRecord
+	if !rect.Hit(primitives.NewRay(origin, direction), 0.001, math.MaxFloat64, &rec) {
+		return 0
+	}
+	return areaToSolidAngle(1/rect.Area(), origin, rec.Point(), rec.Normal())
+}
@@ -4,6 +4,7 @@ import (
 	"math"
 	"raytracer/materials"
 	"raytracer/primitives"
+	"raytracer/sampling"
 	"raytracer/transformations"
 	"raytracer/utils"
 
@@ -35,6 +36,7 @@ func NewSphereWithTransform(center primitives.Vec3, radius float64, mat material
 // Hit returns true if a ray intersects with the sphere and stores the result in
 // the passed record.
 func (s *Sphere) Hit(r *primitives.Ray, tMin, tMax float64, rec *materials.HitRecord) bool {
+	rec.CountPrimitive()
 	if s.toObject != nil {
 		r = transformations.TransformRay(s.toObject, r)
 	}
@@ -76,3 +78,98 @@ func (s *Sphere) BoundingBox(t0, t1 float64) (bool, *AABB) {
 	radii := primitives.NewVec3(s.radius, s.radius, s.radius)
 	return true, NewAABB(s.center.Subtract(radii), s.center.Add(radii))
 }
+
+// Material returns the material of the sphere.
+func (s *Sphere) Material() materials.Material {
+	return s.mat
+}
+
+// Area returns the surface area of the sphere.
+func (s *Sphere) Area() float64 {
+	return 4 * math.Pi * s.radius * s.radius
+}
+
+// SampleArea stores a point distributed uniformly over the surface of the
+// sphere in rec and returns the area density of picking it.
+func (s *Sphere) SampleArea(rec *materials.HitRecord, sampler sampling.Sampler) float64 {
+	normal := utils.RandomOnUnitSphere(sampler)
+	p := s.center.Add(normal.MultiplyScalar(s.radius))
+	u, v := utils.GetSphereUV(normal)
+	rec.UpdateRecord(0, u, v, p, normal, s.mat)
+	return 1 / s.Area()
+}
+
+// SampleSolidAngle stores a point on the sphere in rec by sampling the cone
+// of directions the sphere subtends as seen from origin, and returns the
+// solid angle density of the direction. origin must be outside the sphere.
+func (s *Sphere) SampleSolidAngle(origin primitives.Vec3, rec *materials.HitRecord, sampler sampling.Sampler) float64 {
+	toCenter := s.center.Subtract(origin)
+	distance := toCenter.Magnitude()
+	w := toCenter.DivideScalar(distance)
+	cosThetaMax := s.cosThetaMax(distance)
+	u1, u2 := sampler.Get2D()
+	cosTheta := 1 - u1*(1-cosThetaMax)
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	phi := 2 * math.Pi * u2
+	a, b := utils.OrthonormalBasis(w)
+	direction := a.MultiplyScalar(sinTheta * math.Cos(phi)).
+		Add(b.MultiplyScalar(sinTheta * math.Sin(phi))).
+		Add(w.MultiplyScalar(cosTheta))
+	// Distance along direction to the near side of the sphere.
+	t := distance*cosTheta -
+		math.Sqrt(math.Max(0, s.radius*s.radius-distance*distance*sinTheta*sinTheta))
+	p := origin.Add(direction.MultiplyScalar(t))
+	normal := p.Subtract(s.center).DivideScalar(s.radius)
+	u, v := utils.GetSphereUV(normal)
+	rec.UpdateRecord(t, u, v, p, normal, s.mat)
+	return 1 / (2 * math.Pi * (1 - cosThetaMax))
+}
+
+// Sample stores a point on the sphere as seen from origin in rec and returns
+// its solid angle density. Points outside the sphere sample the subtended
+// cone, points inside sample the surface uniformly. Transformed spheres can
+// not be sampled.
+func (s *Sphere) Sample(origin primitives.Vec3, rec *materials.HitRecord, sampler sampling.Sampler) float64 {
+	if s.toWorld != nil {
+		return 0
+	}
+	if origin.Subtract(s.center).SquaredMagnitude() > s.radius*s.radius {
+		return s.SampleSolidAngle(origin, rec, sampler)
+	}
+	pdf := s.SampleArea(rec, sampler)
+	return areaToSolidAngle(pdf, origin, rec.Point(), rec.Normal())
+}
+
+// PDF returns the density with which Sample picks the point the ray from
+// origin along direction hits.
+func (s *Sphere) PDF(origin, direction primitives.Vec3) float64 {
+	if s.toWorld != nil {
+		return 0
+	}
+	var rec materials.HitRecord
+	if !s.Hit(primitives.NewRay(origin, direction), 0.001, math.MaxFloat64, &rec) {
+		return 0
+	}
+	distance := origin.Subtract(s.center).Magnitude()
+	if distance > s.radius {
+		return 1 / (2 * math.Pi * (1 - s.cosThetaMax(distance)))
+	}
+	return areaToSolidAngle(1/s.Area(), origin, rec.Point(), rec.Normal())
+}
+
+func (s *Sphere) cosThetaMax(distance float64) float64 {
+	sinThetaMax := s.radius / distance
+	return math.Sqrt(math.Max(0, 1-sinThetaMax*sinThetaMax))
+}
+
+// areaToSolidAngle converts a density over the area around p with normal n to
+// a density over the directions from origin.
+func areaToSolidAngle(pdf float64, origin, p, n primitives.Vec3) float64 {
+	toPoint := p.Subtract(origin)
+	distanceSquared := toPoint.SquaredMagnitude()
+	cosine := math.Abs(n.Dot(toPoint)) / math.Sqrt(distanceSquared)
+	if cosine == 0 {
+		return 0
+	}
+	return pdf * distanceSquared / cosine
+}
@@ -29,6 +29,7 @@ func NewTriangleNormals(v1, v2, v3, n1, n2, n3 primitives.Vec3, mat materials.Ma
 // Hit returns true if a ray intersects with the triangle and stores the result
 // in the passed record.
 func (t *Triangle) Hit(r *primitives.Ray, tMin, tMax float64, rec *materials.HitRecord) bool {
+	rec.CountPrimitive()
 	e1 := t.v2.Subtract(t.v1)
 	e2 := t.v3.Subtract(t.v1)
 	pv := r.Direction().Cross(e2)
@@ -92,3 +93,8 @@ func (t *Triangle) BoundingBox(t0, t1 float64) (bool, *AABB) {
 	big := primitives.NewVec3(maxX, maxY, maxZ)
 	return true, NewAABB(small, big)
 }
+
+// Material returns the material of the triangle.
+func (t *Triangle) Material() materials.Material {
+	return t.mat
+}
@@ -39,7 +39,7 @@ func parseElement(t []string) [][3]int32 {
 		if len(f) < 3 {
 			addon := 3 - len(f)
 			for k := 0; k < addon; k++ {
-				e[i][k + 1] = -1
+				e[i][k+1] = -1
 			}
 		}
 	}
@@ -52,9 +52,14 @@ func parseElement(t []string) [][3]int32 {
 	return e
 }
 
-// ParseObj ...
-func ParseObj(filename string) ([]float64, []float64) {
-	fp, _ := os.Open(filename)
+// ParseObj returns the vertices and normals of the triangles of the Wavefront
+// OBJ file filename, three numbers per vertex.
+func ParseObj(filename string) ([]float64, []float64, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fp.Close()
 	scanner := bufio.NewScanner(fp)
 
 	vertices := [][]float64{}
@@ -79,6 +84,10 @@ func ParseObj(filename string) ([]float64, []float64) {
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
 	for _, e := range elements {
 		if e[0] >= 0 {
 			vertOut = append(vertOut, vertices[e[0]]...)
@@ -88,5 +97,5 @@ func ParseObj(filename string) ([]float64, []float64) {
 		}
 	}
 
-	return vertOut, normOut
+	return vertOut, normOut, nil
 }
@@ -4,6 +4,7 @@ import (
 	"raytracer/base"
 	"raytracer/materials"
 	"raytracer/objects"
+	"raytracer/postprocess"
 	"raytracer/primitives"
 	"raytracer/textures"
 
@@ -15,13 +16,21 @@ type Options struct {
 	nx, ny, ns                int
 	vfov, aperture, distFocus float64
 	film                      *base.Film
-	camera                    *base.Camera
+	toneMapping               *postprocess.ToneMapping
+	camera                    base.CameraModel
 	ambientLight              materials.Light
 	lights                    []materials.Light
 	world                     *objects.ObjectList
 	mat                       materials.Material
 	transforms                []*mat64.Dense
 	fovcam                    bool
+	orthoWidth                float64
+	panorama                  string
+	physical                  *base.PhysicalCamera
+	panoramaFOV               float64
+	keyframes                 []base.Keyframe
+	stereo                    bool
+	stereoLayout              base.StereoLayout
 }
 
 // WithOptions returns an options struct with the specified parameters
@@ -39,7 +48,8 @@ func WithOptions(parameters ...func(*Options)) *Options {
 		lights: make([]materials.Light, 0, 10), world: objects.NewEmptyObjectList(10),
 		mat: materials.NewBlinnphong(textures.White, textures.White, textures.White,
 			textures.White, 1.0, materials.NewAmbientLight(textures.White)),
-		transforms: make([]*mat64.Dense, 0, 3)}
+		transforms:  make([]*mat64.Dense, 0, 3),
+		toneMapping: postprocess.NewToneMapping(postprocess.Clip, 0)}
 	for _, f := range parameters {
 		f(opts)
 	}
@@ -51,6 +61,13 @@ func (o *Options) SetDimensions(nx, ny int) {
 	o.nx = nx
 	o.ny = ny
 	o.film = base.NewFilm(nx, ny)
+	o.film.SetToneMapping(o.toneMapping)
+}
+
+// SetToneMapping ...
+func (o *Options) SetToneMapping(toneMapping *postprocess.ToneMapping) {
+	o.toneMapping = toneMapping
+	o.film.SetToneMapping(toneMapping)
 }
 
 // SetAntialiasing ...
@@ -59,7 +76,7 @@ func (o *Options) SetAntialiasing(ns int) {
 }
 
 // SetCamera ...
-func (o *Options) SetCamera(cam *base.Camera) {
+func (o *Options) SetCamera(cam base.CameraModel) {
 	o.camera = cam
 }
 
@@ -93,6 +110,44 @@ func (o *Options) SetFOVCam(fovcam bool) {
 	o.fovcam = fovcam
 }
 
+// SetOrthographic makes cam lines create orthographic cameras that show
+// width units across. Zero keeps them perspective.
+func (o *Options) SetOrthographic(width float64) {
+	o.orthoWidth = width
+}
+
+// SetPhysical makes cam lines create cameras with the settings of physical,
+// in focus at the center of their view, realistic ones if it has a lens.
+// Nil uses the corners and flags.
+func (o *Options) SetPhysical(physical *base.PhysicalCamera) {
+	o.physical = physical
+}
+
+// SetPanorama makes cam lines create the panoramic camera with the given
+// name, fisheyes with a field of view of fov degrees. An empty name keeps
+// them perspective.
+func (o *Options) SetPanorama(name string, fov float64) {
+	o.panorama = name
+	o.panoramaFOV = fov
+}
+
+// SetStereo makes cameras fit their view to the half of the image that one
+// eye of a stereo rig with the given layout gets.
+func (o *Options) SetStereo(layout base.StereoLayout) {
+	o.stereo = true
+	o.stereoLayout = layout
+}
+
+// aspect returns the aspect ratio of the image a camera renders, that of one
+// eye for stereo.
+func (o *Options) aspect() float64 {
+	aspect := float64(o.nx) / float64(o.ny)
+	if o.stereo {
+		return o.stereoLayout.EyeAspect(aspect)
+	}
+	return aspect
+}
+
 // AddLights ...
 func (o *Options) AddLights(lights ...materials.Light) {
 	for _, l := range lights {
@@ -108,7 +163,7 @@ func (o *Options) AddObjects(objects ...objects.Object) {
 }
 
 // GetCamera ...
-func (o *Options) GetCamera() *base.Camera {
+func (o *Options) GetCamera() base.CameraModel {
 	return o.camera
 }
 
@@ -3,11 +3,12 @@ package parsers
 import (
 	"bufio"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"raytracer/base"
 	"raytracer/materials"
 	"raytracer/objects"
+	"raytracer/postprocess"
 	"raytracer/primitives"
 	"raytracer/textures"
 	"raytracer/transformations"
@@ -17,65 +18,154 @@ import (
 	"github.com/gonum/matrix/mat64"
 )
 
-// ParseFile ...
-func ParseFile(filename string, opt *Options) {
+// ParseFile parses the scene file filename into opt.
+func ParseFile(filename string, opt *Options) error {
 	file, err := os.Open(filename)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		parseLine(strings.Fields(scanner.Text()), opt)
+	if err := Parse(file, opt); err != nil {
+		return fmt.Errorf("%s:%v", filename, err)
 	}
+	return nil
+}
+
+// Parse parses a scene from r into opt. Errors are prefixed with the number
+// of the line they occurred on.
+func Parse(r io.Reader, opt *Options) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		if err := parseLine(strings.Fields(scanner.Text()), opt); err != nil {
+			return fmt.Errorf("%d: %v", n, err)
+		}
+	}
+	return scanner.Err()
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+// floats parses the n numbers that follow the directive at line[i].
+func floats(line []string, i, n int) ([]float64, error) {
+	if i+n >= len(line) {
+		return nil, fmt.Errorf("%s takes %d numbers, got %d", line[i], n, len(line)-i-1)
 	}
+	v := make([]float64, n)
+	for k := range v {
+		var err error
+		if v[k], err = strconv.ParseFloat(line[i+k+1], 64); err != nil {
+			return nil, fmt.Errorf("%s: %v", line[i], err)
+		}
+	}
+	return v, nil
 }
 
-func parseLine(line []string, opt *Options) {
+func parseLine(line []string, opt *Options) error {
 	for i := 0; i < len(line); i++ {
 		if line[i] == "cam" {
-			ex, _ := strconv.ParseFloat(line[i+1], 64)
-			ey, _ := strconv.ParseFloat(line[i+2], 64)
-			ez, _ := strconv.ParseFloat(line[i+3], 64)
-
-			llx, _ := strconv.ParseFloat(line[i+4], 64)
-			lly, _ := strconv.ParseFloat(line[i+5], 64)
-			llz, _ := strconv.ParseFloat(line[i+6], 64)
-
-			lrx, _ := strconv.ParseFloat(line[i+7], 64)
-			lry, _ := strconv.ParseFloat(line[i+8], 64)
-			lrz, _ := strconv.ParseFloat(line[i+9], 64)
-
-			ulx, _ := strconv.ParseFloat(line[i+10], 64)
-			uly, _ := strconv.ParseFloat(line[i+11], 64)
-			ulz, _ := strconv.ParseFloat(line[i+12], 64)
-
-			urx, _ := strconv.ParseFloat(line[i+13], 64)
-			ury, _ := strconv.ParseFloat(line[i+14], 64)
-			urz, _ := strconv.ParseFloat(line[i+15], 64)
-
-			eye := primitives.NewVec3(ex, ey, ez)
-			LL := primitives.NewVec3(llx, lly, llz)
-			LR := primitives.NewVec3(lrx, lry, lrz)
-			UL := primitives.NewVec3(ulx, uly, ulz)
-			UR := primitives.NewVec3(urx, ury, urz)
+			v, err := floats(line, i, 15)
+			if err != nil {
+				return err
+			}
+			eye := primitives.NewVec3(v[0], v[1], v[2])
+			LL := primitives.NewVec3(v[3], v[4], v[5])
+			LR := primitives.NewVec3(v[6], v[7], v[8])
+			UL := primitives.NewVec3(v[9], v[10], v[11])
+			UR := primitives.NewVec3(v[12], v[13], v[14])
 
-			nx := float64(opt.nx)
-			ny := float64(opt.ny)
-			camera := base.NewCameraFromCoordinates(LL, LR, UL, UR, eye, nx, ny,
+			aspect := opt.aspect()
+			// The corners frame the whole image, the view of one eye of a
+			// stereo rig is narrowed or widened to fit its half.
+			if scale := aspect * float64(opt.ny) / float64(opt.nx); scale != 1 {
+				h := LR.Subtract(LL).MultiplyScalar((scale - 1) / 2)
+				LL, UL = LL.Subtract(h), UL.Subtract(h)
+				LR, UR = LR.Add(h), UR.Add(h)
+			}
+			camera := base.NewCameraFromCoordinates(LL, LR, UL, UR, eye, aspect, 1,
 				opt.vfov, opt.aperture, opt.distFocus, opt.fovcam)
-			opt.SetCamera(camera)
+			lookat := LL.Add(LR).Add(UL).Add(UR).DivideScalar(4)
+			if opt.panorama != "" {
+				panorama, err := base.NewPanoramicCamera(opt.panorama, eye, lookat,
+					UL.Subtract(LL), opt.panoramaFOV, aspect, 0, 1)
+				if err != nil {
+					return err
+				}
+				opt.SetCamera(panorama)
+			} else if opt.orthoWidth > 0 {
+				opt.SetCamera(base.NewCameraOrthographic(eye, lookat, UL.Subtract(LL),
+					opt.orthoWidth, opt.orthoWidth/aspect, 0, 1))
+			} else if opt.physical != nil && opt.physical.Lens != nil {
+				realistic, err := opt.physical.Realistic(eye, lookat, UL.Subtract(LL), aspect)
+				if err != nil {
+					return err
+				}
+				opt.SetCamera(realistic)
+			} else if opt.physical != nil {
+				opt.SetCamera(opt.physical.Camera(eye, lookat, UL.Subtract(LL), aspect))
+			} else {
+				opt.SetCamera(camera)
+			}
 			i += 15
 			continue
+		} else if line[i] == "ort" {
+			v, err := floats(line, i, 11)
+			if err != nil {
+				return err
+			}
+			eye := primitives.NewVec3(v[0], v[1], v[2])
+			lookat := primitives.NewVec3(v[3], v[4], v[5])
+			vup := primitives.NewVec3(v[6], v[7], v[8])
+			opt.SetCamera(base.NewCameraOrthographic(eye, lookat, vup, v[9], v[10], 0, 1))
+			i += 11
+			continue
+		} else if line[i] == "pan" {
+			if i+1 >= len(line) {
+				return fmt.Errorf("pan takes a camera type")
+			}
+			v, err := floats(line, i+1, 9)
+			if err != nil {
+				return err
+			}
+			// The field of view of fisheyes is optional.
+			fov := 180.0
+			n := 10
+			if i+11 < len(line) {
+				if f, err := strconv.ParseFloat(line[i+11], 64); err == nil {
+					fov = f
+					n++
+				}
+			}
+			camera, err := base.NewPanoramicCamera(line[i+1], primitives.NewVec3(v[0], v[1], v[2]),
+				primitives.NewVec3(v[3], v[4], v[5]), primitives.NewVec3(v[6], v[7], v[8]),
+				fov, opt.aspect(), 0, 1)
+			if err != nil {
+				return err
+			}
+			opt.SetCamera(camera)
+			i += n
+			continue
+		} else if line[i] == "key" {
+			v, err := floats(line, i, 11)
+			if err != nil {
+				return err
+			}
+			opt.keyframes = append(opt.keyframes, base.Keyframe{Time: v[0],
+				Origin: primitives.NewVec3(v[1], v[2], v[3]),
+				LookAt: primitives.NewVec3(v[4], v[5], v[6]),
+				Up:     primitives.NewVec3(v[7], v[8], v[9]), VFOV: v[10]})
+			camera, err := base.NewAnimatedCamera(opt.keyframes,
+				opt.aspect(), opt.aperture, 0, 1)
+			if err != nil {
+				return err
+			}
+			opt.SetCamera(camera)
+			i += 11
+			continue
 		} else if line[i] == "sph" {
-			cx, _ := strconv.ParseFloat(line[i+1], 64)
-			cy, _ := strconv.ParseFloat(line[i+2], 64)
-			cz, _ := strconv.ParseFloat(line[i+3], 64)
-			r, _ := strconv.ParseFloat(line[i+4], 64)
+			v, err := floats(line, i, 4)
+			if err != nil {
+				return err
+			}
+			cx, cy, cz, r := v[0], v[1], v[2], v[3]
 			if len(opt.transforms) > 0 {
 				transform := transformations.Coalesce(opt.transforms)
 				opt.AddObjects(objects.NewSphereWithTransform(
@@ -87,21 +177,13 @@ func parseLine(line []string, opt *Options) {
 			i += 4
 			continue
 		} else if line[i] == "tri" {
-			ax, _ := strconv.ParseFloat(line[i+1], 64)
-			ay, _ := strconv.ParseFloat(line[i+2], 64)
-			az, _ := strconv.ParseFloat(line[i+3], 64)
-
-			bx, _ := strconv.ParseFloat(line[i+4], 64)
-			by, _ := strconv.ParseFloat(line[i+5], 64)
-			bz, _ := strconv.ParseFloat(line[i+6], 64)
-
-			cx, _ := strconv.ParseFloat(line[i+7], 64)
-			cy, _ := strconv.ParseFloat(line[i+8], 64)
-			cz, _ := strconv.ParseFloat(line[i+9], 64)
-
-			v1 := primitives.NewVec3(ax, ay, az)
-			v2 := primitives.NewVec3(bx, by, bz)
-			v3 := primitives.NewVec3(cx, cy, cz)
+			v, err := floats(line, i, 9)
+			if err != nil {
+				return err
+			}
+			v1 := primitives.NewVec3(v[0], v[1], v[2])
+			v2 := primitives.NewVec3(v[3], v[4], v[5])
+			v3 := primitives.NewVec3(v[6], v[7], v[8])
 			if len(opt.transforms) > 0 {
 				transform := transformations.Coalesce(opt.transforms)
 				v1 = transformations.Transform(transform, v1)
@@ -113,9 +195,15 @@ func parseLine(line []string, opt *Options) {
 			i += 9
 			continue
 		} else if line[i] == "obj" {
+			if i+1 >= len(line) {
+				return fmt.Errorf("obj takes a file name")
+			}
 			i++
 			// vertices is a list of floats that can be read in by threes
-			vToks, nToks := ParseObj(line[i])
+			vToks, nToks, err := ParseObj(line[i])
+			if err != nil {
+				return err
+			}
 			if len(vToks) == len(nToks) && len(vToks) > 0 {
 				for j := 0; j < len(vToks); j = j + 9 {
 					v1 := primitives.NewVec3(vToks[j], vToks[j+1], vToks[j+2])
@@ -155,105 +243,110 @@ func parseLine(line []string, opt *Options) {
 
 			continue
 		} else if line[i] == "ltp" {
-			px, _ := strconv.ParseFloat(line[i+1], 64)
-			py, _ := strconv.ParseFloat(line[i+2], 64)
-			pz, _ := strconv.ParseFloat(line[i+3], 64)
-
-			r, _ := strconv.ParseFloat(line[i+4], 64)
-			g, _ := strconv.ParseFloat(line[i+5], 64)
-			b, _ := strconv.ParseFloat(line[i+6], 64)
-			falloff, err := strconv.ParseInt(line[i+7], 10, 32)
+			v, err := floats(line, i, 6)
 			if err != nil {
-				falloff = 0
+				return err
 			}
-
-			location := primitives.NewVec3(px, py, pz)
-			color := textures.NewColor(r, g, b)
-			opt.AddLights(materials.NewPointLight(location, color, int(falloff)))
-			if err != nil {
-				i += 6
-			} else {
-				i += 7
+			location := primitives.NewVec3(v[0], v[1], v[2])
+			color := textures.NewColor(v[3], v[4], v[5])
+			i += 6
+			// The falloff is optional.
+			falloff := 0
+			if i+1 < len(line) {
+				if f, err := strconv.Atoi(line[i+1]); err == nil {
+					falloff = f
+					i++
+				}
 			}
+			opt.AddLights(materials.NewPointLight(location, color, falloff))
 			continue
 		} else if line[i] == "ltd" {
-			dx, _ := strconv.ParseFloat(line[i+1], 64)
-			dy, _ := strconv.ParseFloat(line[i+2], 64)
-			dz, _ := strconv.ParseFloat(line[i+3], 64)
-
-			r, _ := strconv.ParseFloat(line[i+4], 64)
-			g, _ := strconv.ParseFloat(line[i+5], 64)
-			b, _ := strconv.ParseFloat(line[i+6], 64)
-
-			location := primitives.NewVec3(dx, dy, dz)
-			color := textures.NewColor(r, g, b)
+			v, err := floats(line, i, 6)
+			if err != nil {
+				return err
+			}
+			location := primitives.NewVec3(v[0], v[1], v[2])
+			color := textures.NewColor(v[3], v[4], v[5])
 			opt.AddLights(materials.NewDirectionalLight(location, color))
 			i += 6
 			continue
 		} else if line[i] == "lta" {
-			r, _ := strconv.ParseFloat(line[i+1], 64)
-			g, _ := strconv.ParseFloat(line[i+2], 64)
-			b, _ := strconv.ParseFloat(line[i+3], 64)
-			color := textures.NewColor(r, g, b)
+			v, err := floats(line, i, 3)
+			if err != nil {
+				return err
+			}
+			color := textures.NewColor(v[0], v[1], v[2])
 			opt.SetAmbientLight(materials.NewAmbientLight(color))
 			i += 3
 			continue
 		} else if line[i] == "mat" {
-			kar, _ := strconv.ParseFloat(line[i+1], 64)
-			kag, _ := strconv.ParseFloat(line[i+2], 64)
-			kab, _ := strconv.ParseFloat(line[i+3], 64)
-
-			kdr, _ := strconv.ParseFloat(line[i+4], 64)
-			kdg, _ := strconv.ParseFloat(line[i+5], 64)
-			kdb, _ := strconv.ParseFloat(line[i+6], 64)
-
-			ksr, _ := strconv.ParseFloat(line[i+7], 64)
-			ksg, _ := strconv.ParseFloat(line[i+8], 64)
-			ksb, _ := strconv.ParseFloat(line[i+9], 64)
-			phong, _ := strconv.ParseFloat(line[i+10], 64)
-
-			krr, _ := strconv.ParseFloat(line[i+11], 64)
-			krg, _ := strconv.ParseFloat(line[i+12], 64)
-			krb, _ := strconv.ParseFloat(line[i+13], 64)
-
-			ambient := textures.NewColor(kar, kag, kab)
-			diffuse := textures.NewColor(kdr, kdg, kdb)
-			specular := textures.NewColor(ksr, ksg, ksb)
-			reflective := textures.NewColor(krr, krg, krb)
+			v, err := floats(line, i, 13)
+			if err != nil {
+				return err
+			}
+			ambient := textures.NewColor(v[0], v[1], v[2])
+			diffuse := textures.NewColor(v[3], v[4], v[5])
+			specular := textures.NewColor(v[6], v[7], v[8])
+			reflective := textures.NewColor(v[10], v[11], v[12])
 
 			opt.SetMat(materials.NewBlinnphong(ambient, diffuse, specular,
-				reflective, phong, opt.ambientLight))
+				reflective, v[9], opt.ambientLight))
 			i += 13
 			continue
+		} else if line[i] == "tmo" {
+			if i+1 >= len(line) {
+				return fmt.Errorf("tmo takes an operator")
+			}
+			// The exposure and the white point are optional.
+			args := []float64{0, 1}
+			n := 1
+			for ; n <= len(args) && i+n+1 < len(line); n++ {
+				v, err := strconv.ParseFloat(line[i+n+1], 64)
+				if err != nil {
+					break
+				}
+				args[n-1] = v
+			}
+			operator, err := postprocess.ParseOperator(line[i+1], args[1])
+			if err != nil {
+				return err
+			}
+			opt.SetToneMapping(postprocess.NewToneMapping(operator, args[0]))
+			i += n
+			continue
 		} else if line[i] == "xft" {
-			tx, _ := strconv.ParseFloat(line[i+1], 64)
-			ty, _ := strconv.ParseFloat(line[i+2], 64)
-			tz, _ := strconv.ParseFloat(line[i+3], 64)
+			v, err := floats(line, i, 3)
+			if err != nil {
+				return err
+			}
 			opt.transforms = append(opt.transforms,
-				transformations.NewTranslationMatrix(tx, ty, tz))
+				transformations.NewTranslationMatrix(v[0], v[1], v[2]))
 			i += 3
 			continue
 		} else if line[i] == "xfr" {
-			rx, _ := strconv.ParseFloat(line[i+1], 64)
-			ry, _ := strconv.ParseFloat(line[i+2], 64)
-			rz, _ := strconv.ParseFloat(line[i+3], 64)
+			v, err := floats(line, i, 3)
+			if err != nil {
+				return err
+			}
 			opt.transforms = append(opt.transforms,
-				transformations.NewRotationMatrix(rx, ry, rz))
+				transformations.NewRotationMatrix(v[0], v[1], v[2]))
 			i += 3
 			continue
 		} else if line[i] == "xfs" {
-			sx, _ := strconv.ParseFloat(line[i+1], 64)
-			sy, _ := strconv.ParseFloat(line[i+2], 64)
-			sz, _ := strconv.ParseFloat(line[i+3], 64)
+			v, err := floats(line, i, 3)
+			if err != nil {
+				return err
+			}
 			opt.transforms = append(opt.transforms,
-				transformations.NewScalingMatrix(sx, sy, sz))
+				transformations.NewScalingMatrix(v[0], v[1], v[2]))
 			i += 3
 			continue
 		} else if line[i] == "xfz" {
 			opt.transforms = make([]*mat64.Dense, 0, 3)
 			continue
 		} else {
-			fmt.Println("Unexpected argument: ", i, line[i])
+			return fmt.Errorf("unexpected argument %q", line[i])
 		}
 	}
+	return nil
 }
@@ -0,0 +1,107 @@
+package parsers
+
+import (
+	"math"
+	"raytracer/base"
+	"raytracer/primitives"
+	"raytracer/sampling"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	opt := WithOptions()
+	scene := "lta 0.1 0.1 0.1\nltp 1 2 3 1 1 1 2\nltd 0 -1 0 1 1 1\n" +
+		"mat 0 0 0 1 1 1 0 0 0 1 0 0 0\nsph 0 0 -1 0.5\ntri 0 0 0 1 0 0 0 1 0\n"
+	if err := Parse(strings.NewReader(scene), opt); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(opt.GetLights()); n != 2 {
+		t.Errorf("parsed %d lights, want 2", n)
+	}
+}
+
+func TestParseOrthographic(t *testing.T) {
+	opt := WithOptions()
+	if err := Parse(strings.NewReader("ort 0 0 5  0 0 0  0 1 0  4 2\n"), opt); err != nil {
+		t.Fatal(err)
+	}
+	camera, ok := opt.GetCamera().(*base.Camera)
+	if !ok {
+		t.Fatalf("ort line made a %T", opt.GetCamera())
+	}
+	// The rays of an orthographic camera are parallel.
+	sampler := sampling.NewIndependent(1)
+	for _, uv := range [][2]float64{{0, 0}, {1, 1}} {
+		r := camera.GetRay(uv[0], uv[1], sampler)
+		if d := r.Direction().Normalize(); d.Z() > -1+1e-9 {
+			t.Errorf("ray at %v points along %v", uv, d)
+		}
+		if want := primitives.NewVec3(4*uv[0]-2, 2*uv[1]-1, 5); r.Origin().Subtract(want).Magnitude() > 1e-9 {
+			t.Errorf("ray at %v starts at %v, want %v", uv, r.Origin(), want)
+		}
+	}
+}
+
+func TestParseStereoCamera(t *testing.T) {
+	// The corners frame a view twice as wide as high for a 200x100 image.
+	scene := "cam 0 0 0  -2 -1 -1  2 -1 -1  -2 1 -1  2 1 -1\n"
+	for _, test := range []struct {
+		layout base.StereoLayout
+		x, y   float64
+	}{{base.SideBySide, 1, 1}, {base.TopBottom, 4, 1}} {
+		opt := WithOptions()
+		opt.SetDimensions(200, 100)
+		opt.SetStereo(test.layout)
+		if err := Parse(strings.NewReader(scene), opt); err != nil {
+			t.Fatal(err)
+		}
+		rig, err := base.NewStereoRig(opt.GetCamera(), 0, 0, test.layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The left eye gets a 100x100 image side by side and a 200x50 one
+		// top and bottom, its view has the same aspect ratio.
+		sampler := sampling.NewIndependent(1)
+		right, top := rig.GetRay(0.5-1e-12, 0.75, sampler), rig.GetRay(0.25, 1, sampler)
+		if test.layout == base.TopBottom {
+			right, top = rig.GetRay(1, 0.75, sampler), rig.GetRay(0.5, 1, sampler)
+		}
+		x := right.PointAt(-1 / right.Direction().Z()).X()
+		y := top.PointAt(-1 / top.Direction().Z()).Y()
+		if math.Abs(x-test.x) > 1e-6 || math.Abs(y-test.y) > 1e-6 {
+			t.Errorf("eye of %v sees up to (%v, %v), want (%v, %v)", test.layout, x, y, test.x, test.y)
+		}
+	}
+}
+
+func TestParseKeyframes(t *testing.T) {
+	opt := WithOptions()
+	scene := "key 0  0 0 0  0 0 -1  0 1 0  40\nkey 2  2 0 0  2 0 -1  0 1 0  40\n"
+	if err := Parse(strings.NewReader(scene), opt); err != nil {
+		t.Fatal(err)
+	}
+	camera, ok := opt.GetCamera().(*base.AnimatedCamera)
+	if !ok {
+		t.Fatalf("key lines made a %T", opt.GetCamera())
+	}
+	if t0, t1 := camera.Span(); t0 != 0 || t1 != 2 {
+		t.Errorf("keyframes span %v to %v, want 0 to 2", t0, t1)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for scene, want := range map[string]string{
+		"sph 0 0 -1\n":           "1: sph takes 4 numbers, got 3",
+		"lta 1 1 1\nsph a 0 0 1": "2: sph: ",
+		"tmo bogus\n":            "1: ",
+		"foo 1 2 3\n":            `1: unexpected argument "foo"`,
+		"key 0 0 0 0 0 0 -1 0 1 0 40\nkey 0 1 0 0 1 0 -1 0 1 0 40\n": "2: ",
+		"obj missing.obj\n": "1: open missing.obj",
+	} {
+		err := Parse(strings.NewReader(scene), WithOptions())
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("Parse(%q) = %v, want %q", scene, err, want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package postprocess
+
+import (
+	"math"
+	"raytracer/textures"
+)
+
+// Denoiser removes noise from a rendered image with an edge-avoiding à-trous
+// wavelet filter. Every iteration blurs the image with a 5x5 kernel whose
+// taps are twice as far apart as in the previous one, so a few iterations
+// cover a wide area. Each tap is weighted down when its normal, depth or
+// albedo differs from the center pixel, which keeps geometric and texture
+// edges sharp, and when its luminance differs by more than the noise of the
+// center pixel can explain. The image is divided by the albedo before
+// filtering so textures are not blurred, and multiplied back afterwards.
+// [Dammertz et al., Edge-Avoiding À-Trous Wavelet Transform for fast Global
+// Illumination Filtering]
+// [Schied et al., Spatiotemporal Variance-Guided Filtering]
+type Denoiser struct {
+	iterations     int
+	sigmaLuminance float64
+	sigmaNormal    float64
+	sigmaDepth     float64
+	sigmaAlbedo    float64
+}
+
+// Guides are the buffers that steer the denoiser, one value per pixel row by
+// row. Pixels where the camera ray missed have a zero normal. Variance is
+// the variance of the mean luminance of each pixel, infinite when unknown.
+// Any of the buffers may be nil.
+type Guides struct {
+	Normal, Albedo  []textures.Color
+	Depth, Variance []float64
+}
+
+// NewDenoiser returns a denoiser that runs the given number of iterations.
+func NewDenoiser(iterations int) *Denoiser {
+	return &Denoiser{iterations: iterations, sigmaLuminance: 4, sigmaNormal: 128,
+		sigmaDepth: 0.05, sigmaAlbedo: 0.1}
+}
+
+// kernel is the B3 spline the wavelet transform is built on.
+var kernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+// Denoise returns the denoised width x height image color.
+func (d *Denoiser) Denoise(width, height int, color []textures.Color, guides Guides) []textures.Color {
+	n := width * height
+	current := make([]textures.Color, n)
+	for k := range color {
+		current[k] = demodulate(color[k], guides.Albedo, k)
+	}
+	variance := make([]float64, n)
+	for k := range variance {
+		variance[k] = math.Inf(1)
+		if guides.Variance != nil {
+			// Demodulating scales the luminance and with it the noise.
+			scale := demodulate(textures.White, guides.Albedo, k).Luminance()
+			variance[k] = guides.Variance[k] * scale * scale
+		}
+	}
+
+	next := make([]textures.Color, n)
+	nextVariance := make([]float64, n)
+	for i := 0; i < d.iterations; i++ {
+		step := 1 << uint(i)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				next[y*width+x], nextVariance[y*width+x] = d.filter(x, y, step,
+					width, height, current, variance, guides)
+			}
+		}
+		current, next = next, current
+		variance, nextVariance = nextVariance, variance
+	}
+
+	for k := range current {
+		current[k] = remodulate(current[k], guides.Albedo, k)
+	}
+	return current
+}
+
+// filter returns the filtered color and variance of pixel (x, y) for an
+// iteration with taps step pixels apart.
+func (d *Denoiser) filter(x, y, step, width, height int, color []textures.Color, variance []float64, guides Guides) (textures.Color, float64) {
+	p := y*width + x
+	lp := color[p].Luminance()
+	// The allowed luminance difference scales with the noise of the pixel.
+	sigmaL := d.sigmaLuminance*math.Sqrt(localVariance(x, y, width, height, variance)) + 1e-6
+
+	sum := textures.Black
+	sumVariance := 0.0
+	sumWeight := 0.0
+	for j := -2; j <= 2; j++ {
+		qy := y + j*step
+		if qy < 0 || qy >= height {
+			continue
+		}
+		for i := -2; i <= 2; i++ {
+			qx := x + i*step
+			if qx < 0 || qx >= width {
+				continue
+			}
+			q := qy*width + qx
+			w := kernel[i+2] * kernel[j+2]
+			if q != p {
+				w *= math.Exp(-math.Abs(lp-color[q].Luminance()) / sigmaL)
+				w *= d.guideWeight(p, q, step*int(math.Max(math.Abs(float64(i)), math.Abs(float64(j)))), guides)
+			}
+			if w == 0 {
+				continue
+			}
+			sum = sum.Add(color[q].MultiplyScalar(w))
+			sumVariance += w * w * variance[q]
+			sumWeight += w
+		}
+	}
+	return sum.DivideScalar(sumWeight), sumVariance / (sumWeight * sumWeight)
+}
+
+// localVariance returns the variance around pixel (x, y) blurred with a 3x3
+// Gaussian, which keeps pixels whose few samples happen to agree from being
+// taken as noise free.
+func localVariance(x, y, width, height int, variance []float64) float64 {
+	gaussian := [3]float64{1.0 / 4, 1.0 / 2, 1.0 / 4}
+	sum, sumWeight := 0.0, 0.0
+	for j := -1; j <= 1; j++ {
+		for i := -1; i <= 1; i++ {
+			qx, qy := x+i, y+j
+			if qx < 0 || qx >= width || qy < 0 || qy >= height {
+				continue
+			}
+			w := gaussian[i+1] * gaussian[j+1]
+			sum += w * math.Max(variance[qy*width+qx], 0)
+			sumWeight += w
+		}
+	}
+	return sum / sumWeight
+}
+
+// guideWeight returns how much pixel q, distance pixels away, is allowed to
+// contribute to pixel p according to the guides.
+func (d *Denoiser) guideWeight(p, q, distance int, guides Guides) float64 {
+	w := 1.0
+	if guides.Normal != nil {
+		np, nq := guides.Normal[p], guides.Normal[q]
+		hitP := np != textures.Black
+		hitQ := nq != textures.Black
+		if hitP != hitQ {
+			return 0
+		}
+		if hitP {
+			dot := np.R*nq.R + np.G*nq.G + np.B*nq.B
+			dot /= math.Sqrt((np.R*np.R + np.G*np.G + np.B*np.B) * (nq.R*nq.R + nq.G*nq.G + nq.B*nq.B))
+			w *= math.Pow(math.Max(0, dot), d.sigmaNormal)
+		}
+	}
+	if guides.Depth != nil {
+		zp, zq := guides.Depth[p], guides.Depth[q]
+		w *= math.Exp(-math.Abs(zp-zq) / (d.sigmaDepth*zp*float64(distance) + 1e-6))
+	}
+	if guides.Albedo != nil {
+		ap, aq := guides.Albedo[p], guides.Albedo[q]
+		dr, dg, db := ap.R-aq.R, ap.G-aq.G, ap.B-aq.B
+		w *= math.Exp(-(dr*dr + dg*dg + db*db) / (d.sigmaAlbedo * d.sigmaAlbedo))
+	}
+	return w
+}
+
+// albedoEpsilon keeps dark albedos from blowing up the demodulated image.
+const albedoEpsilon = 0.01
+
+// demodulate divides the color of pixel k by its albedo.
+func demodulate(c textures.Color, albedo []textures.Color, k int) textures.Color {
+	if albedo == nil {
+		return c
+	}
+	a := albedo[k]
+	return textures.NewColor(c.R/(a.R+albedoEpsilon), c.G/(a.G+albedoEpsilon),
+		c.B/(a.B+albedoEpsilon))
+}
+
+// remodulate undoes demodulate.
+func remodulate(c textures.Color, albedo []textures.Color, k int) textures.Color {
+	if albedo == nil {
+		return c
+	}
+	a := albedo[k]
+	return textures.NewColor(c.R*(a.R+albedoEpsilon), c.G*(a.G+albedoEpsilon),
+		c.B*(a.B+albedoEpsilon))
+}
@@ -0,0 +1,77 @@
+package postprocess
+
+import (
+	"math"
+	"math/rand"
+	"raytracer/textures"
+	"testing"
+)
+
+// noisyImage returns a 32x32 image whose left half is 0.2 and right half is
+// 0.8, with noise added, along with guides that tell the halves apart by
+// their normals.
+func noisyImage() ([]textures.Color, Guides) {
+	rng := rand.New(rand.NewSource(1))
+	color := make([]textures.Color, 32*32)
+	guides := Guides{Normal: make([]textures.Color, 32*32), Variance: make([]float64, 32*32)}
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			k := y*32 + x
+			v, n := 0.2, textures.NewColor(1, 0, 0)
+			if x >= 16 {
+				v, n = 0.8, textures.NewColor(0, 1, 0)
+			}
+			v += (rng.Float64() - 0.5) * 0.2
+			color[k] = textures.NewColor(v, v, v)
+			guides.Normal[k] = n
+			guides.Variance[k] = 0.01 / 12
+		}
+	}
+	return color, guides
+}
+
+// halfError returns the root mean square error of each half of the image.
+func halfError(color []textures.Color) (float64, float64) {
+	var left, right float64
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if c := color[y*32+x].G; x < 16 {
+				left += (c - 0.2) * (c - 0.2)
+			} else {
+				right += (c - 0.8) * (c - 0.8)
+			}
+		}
+	}
+	return math.Sqrt(left / 512), math.Sqrt(right / 512)
+}
+
+func TestDenoiseRemovesNoiseAndKeepsEdges(t *testing.T) {
+	color, guides := noisyImage()
+	left, right := halfError(color)
+	denoised := NewDenoiser(5).Denoise(32, 32, color, guides)
+	dleft, dright := halfError(denoised)
+	if dleft > left/3 || dright > right/3 {
+		t.Errorf("error went from %v, %v to %v, %v", left, right, dleft, dright)
+	}
+	// The pixels right next to the edge must not bleed into each other.
+	for y := 0; y < 32; y++ {
+		if l, r := denoised[y*32+15].G, denoised[y*32+16].G; l > 0.35 || r < 0.65 {
+			t.Fatalf("edge is blurred in row %d: %v %v", y, l, r)
+		}
+	}
+}
+
+func TestDenoiseKeepsConstantImages(t *testing.T) {
+	c := textures.NewColor(0.5, 2, 0.1)
+	color := make([]textures.Color, 10*7)
+	albedo := make([]textures.Color, len(color))
+	for k := range color {
+		color[k] = c
+		albedo[k] = textures.NewColor(0.3, 0.6, 0.9)
+	}
+	for _, p := range NewDenoiser(3).Denoise(10, 7, color, Guides{Albedo: albedo}) {
+		if math.Abs(p.R-c.R) > 1e-9 || math.Abs(p.G-c.G) > 1e-9 || math.Abs(p.B-c.B) > 1e-9 {
+			t.Fatalf("constant image changed to %v", p)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package postprocess
+
+import (
+	"fmt"
+	"math"
+	"raytracer/textures"
+	"strings"
+)
+
+// Operator compresses linear radiance into the displayable range [0, 1].
+type Operator func(c textures.Color) textures.Color
+
+// ToneMapping turns the linear radiance of the film into display values. The
+// radiance is scaled by the exposure, compressed by the operator and encoded
+// with the sRGB transfer function.
+type ToneMapping struct {
+	operator Operator
+	exposure float64
+	transfer func(v float64) float64
+}
+
+// NewToneMapping returns a tone mapping that applies operator after scaling
+// the radiance by 2^exposure.
+func NewToneMapping(operator Operator, exposure float64) *ToneMapping {
+	return &ToneMapping{operator, exposure, SRGB}
+}
+
+// Data returns a tone mapping for images that hold data instead of colors. It
+// only clips the values and skips the sRGB encoding.
+func Data() *ToneMapping {
+	return &ToneMapping{Clip, 0, func(v float64) float64 { return v }}
+}
+
+// Apply returns the encoded display color of the radiance c.
+func (t *ToneMapping) Apply(c textures.Color) textures.Color {
+	c = t.operator(c.MultiplyScalar(math.Exp2(t.exposure)))
+	return textures.NewColor(t.transfer(c.R), t.transfer(c.G), t.transfer(c.B))
+}
+
+// ParseOperator returns the operator with the given name: clip, reinhard,
+// extended, hable or aces. white is the radiance that maps to white for the
+// extended Reinhard operator.
+func ParseOperator(name string, white float64) (Operator, error) {
+	switch strings.ToLower(name) {
+	case "clip":
+		return Clip, nil
+	case "reinhard":
+		return Reinhard, nil
+	case "extended":
+		return ExtendedReinhard(white), nil
+	case "hable":
+		return Hable, nil
+	case "aces":
+		return ACES, nil
+	}
+	return nil, fmt.Errorf("unknown tone mapping operator %q", name)
+}
+
+// SRGB encodes the linear value v with the sRGB transfer function.
+func SRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * math.Max(v, 0)
+	}
+	return 1.055*math.Pow(math.Min(v, 1), 1/2.4) - 0.055
+}
+
+// Clip cuts off every channel at 1.
+func Clip(c textures.Color) textures.Color {
+	return saturate(c)
+}
+
+// Reinhard maps the luminance L to L / (1 + L), keeping the hue.
+// [Reinhard et al., Photographic Tone Reproduction for Digital Images]
+func Reinhard(c textures.Color) textures.Color {
+	l := c.Luminance()
+	return scaleLuminance(c, l, l/(1+l))
+}
+
+// ExtendedReinhard returns the Reinhard operator that maps the luminance
+// white to 1 instead of infinity, so highlights can still burn out.
+func ExtendedReinhard(white float64) Operator {
+	return func(c textures.Color) textures.Color {
+		l := c.Luminance()
+		return scaleLuminance(c, l, l*(1+l/(white*white))/(1+l))
+	}
+}
+
+// Hable is the filmic curve of Uncharted 2, normalized so a radiance of 11.2
+// maps to white.
+// [Hable, Filmic Tonemapping Operators]
+func Hable(c textures.Color) textures.Color {
+	const exposureBias = 2
+	scale := 1 / hable(11.2)
+	return saturate(textures.NewColor(hable(exposureBias*c.R)*scale,
+		hable(exposureBias*c.G)*scale, hable(exposureBias*c.B)*scale))
+}
+
+func hable(x float64) float64 {
+	const a, b, c, d, e, f = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+// ACES is a fit of the ACES reference rendering transform and sRGB output
+// transform. The radiance is moved into the ACES color space, the curve is
+// applied per channel and the result is moved back.
+// [Hill, BakingLab ACES fit]
+func ACES(c textures.Color) textures.Color {
+	c = textures.NewColor(
+		0.59719*c.R+0.35458*c.G+0.04823*c.B,
+		0.07600*c.R+0.90834*c.G+0.01566*c.B,
+		0.02840*c.R+0.13383*c.G+0.83777*c.B)
+	fit := func(v float64) float64 {
+		return (v*(v+0.0245786) - 0.000090537) / (v*(0.983729*v+0.4329510) + 0.238081)
+	}
+	c = textures.NewColor(fit(c.R), fit(c.G), fit(c.B))
+	return saturate(textures.NewColor(
+		1.60475*c.R-0.53108*c.G-0.07367*c.B,
+		-0.10208*c.R+1.10813*c.G-0.00605*c.B,
+		-0.00327*c.R-0.07276*c.G+1.07602*c.B))
+}
+
+// scaleLuminance scales c so its luminance goes from l to mapped.
+func scaleLuminance(c textures.Color, l, mapped float64) textures.Color {
+	if l <= 0 {
+		return textures.Black
+	}
+	return saturate(c.MultiplyScalar(mapped / l))
+}
+
+// saturate clamps every channel to [0, 1].
+func saturate(c textures.Color) textures.Color {
+	clamp := func(v float64) float64 { return math.Max(0, math.Min(1, v)) }
+	return textures.NewColor(clamp(c.R), clamp(c.G), clamp(c.B))
+}
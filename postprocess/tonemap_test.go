@@ -0,0 +1,54 @@
+package postprocess
+
+import (
+	"math"
+	"raytracer/textures"
+	"testing"
+)
+
+func TestSRGB(t *testing.T) {
+	tests := []struct{ in, want float64 }{
+		{-1, 0}, {0, 0}, {0.0031308, 0.04045}, {0.5, 0.735357}, {1, 1}, {4, 1},
+	}
+	for _, test := range tests {
+		if got := SRGB(test.in); math.Abs(got-test.want) > 1e-5 {
+			t.Errorf("SRGB(%v) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestOperatorsAreMonotonic(t *testing.T) {
+	for _, name := range []string{"clip", "reinhard", "extended", "hable", "aces"} {
+		operator, err := ParseOperator(name, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := operator(textures.Black); c != textures.Black {
+			t.Errorf("%s maps black to %v", name, c)
+		}
+		last := 0.0
+		for v := 0.01; v < 100; v *= 1.5 {
+			c := operator(textures.NewColor(v, v, v))
+			if c.G < last || c.G > 1 {
+				t.Fatalf("%s maps %v to %v after %v", name, v, c.G, last)
+			}
+			last = c.G
+		}
+	}
+	if _, err := ParseOperator("bogus", 1); err == nil {
+		t.Error("parsed an unknown operator")
+	}
+}
+
+func TestExtendedReinhardMapsWhiteToOne(t *testing.T) {
+	if c := ExtendedReinhard(4)(textures.NewColor(4, 4, 4)); math.Abs(c.G-1) > 1e-9 {
+		t.Errorf("white maps to %v, want 1", c.G)
+	}
+}
+
+func TestExposure(t *testing.T) {
+	tm := NewToneMapping(Clip, 1)
+	if c := tm.Apply(textures.NewColor(0.25, 0.25, 0.25)); c != NewToneMapping(Clip, 0).Apply(textures.NewColor(0.5, 0.5, 0.5)) {
+		t.Errorf("one stop of exposure gives %v", c)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"raytracer/base"
+	"strings"
+	"time"
+)
+
+// progressBar returns a progress callback that draws a bar with the elapsed
+// and estimated remaining time on w. The bar is redrawn at most ten times a
+// second, and on a line of its own once the render ends.
+func progressBar(w io.Writer) func(base.Progress) {
+	const width = 40
+	var last time.Time
+	finished := false
+	return func(p base.Progress) {
+		done := p.Samples >= p.Total
+		if finished || (!done && time.Since(last) < 100*time.Millisecond) {
+			return
+		}
+		finished = done
+		last = time.Now()
+		filled := int(p.Fraction() * width)
+		if filled > width {
+			filled = width
+		}
+		fmt.Fprintf(w, "\r[%s%s] %3.0f%%  %v elapsed  %v left   ",
+			strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+			100*p.Fraction(), p.Elapsed.Round(time.Second), p.ETA().Round(time.Second))
+		if done {
+			fmt.Fprintln(w)
+		}
+	}
+}
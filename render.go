@@ -8,8 +8,9 @@ import (
 	"raytracer/textures"
 )
 
-// Generates the random scene from `Ray Tracing in One Weekend`
-func randomScene() objects.Object {
+// Generates the random scene from `Ray Tracing in One Weekend` with the
+// objects drawn from rng.
+func randomScene(rng *rand.Rand) objects.Object {
 	objList := objects.NewEmptyObjectList(500)
 	checkered := textures.NewCheckered(textures.NewColor(0.2, 0.3, 0.1),
 		textures.NewColor(0.9, 0.9, 0.9))
@@ -22,23 +23,23 @@ func randomScene() objects.Object {
 	for a := -11; a < 11; a++ {
 		for b := -11; b < 11; b++ {
 
-			rndMat := rand.Float64()
-			center := primitives.NewVec3(float64(a)+.9*rand.Float64(), 0.2,
-				float64(b)+.9*rand.Float64())
+			rndMat := rng.Float64()
+			center := primitives.NewVec3(float64(a)+.9*rng.Float64(), 0.2,
+				float64(b)+.9*rng.Float64())
 
 			if center.Subtract(primitives.NewVec3(4, 0.2, 0)).Magnitude() > 0.9 {
 				if rndMat < 0.8 {
-					if move := rand.Float64(); move < 0.5 {
+					if move := rng.Float64(); move < 0.5 {
 						objList.Add(objects.NewMovingSphere(center,
-							center.Add(primitives.NewVec3(0, 0.5*(1+rand.Float64()), 0)),
-							0, 1, 0.2, materials.NewLambertian(textures.NewRandomColor())))
+							center.Add(primitives.NewVec3(0, 0.5*(1+rng.Float64()), 0)),
+							0, 1, 0.2, materials.NewLambertian(textures.NewRandomColor(rng))))
 					} else {
 						objList.Add(objects.NewSphere(center, 0.2,
-							materials.NewLambertian(textures.NewRandomColor())))
+							materials.NewLambertian(textures.NewRandomColor(rng))))
 					}
 				} else if rndMat < 0.95 {
 					objList.Add(objects.NewSphere(center, 0.2,
-						materials.NewRandomMetal()))
+						materials.NewRandomMetal(rng)))
 				} else {
 					objList.Add(objects.NewSphere(center, 0.2,
 						materials.NewDielectric(1.5)))
@@ -0,0 +1,82 @@
+package sampling
+
+import (
+	"fmt"
+	"math"
+)
+
+// primes are the bases of the Halton dimensions.
+var primes = []uint64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47,
+	53, 59, 61, 67, 71, 73, 79, 83, 89, 97, 101, 103, 107, 109, 113, 127, 131,
+	137, 139, 149, 151, 157, 163, 167, 173, 179, 181, 191, 193, 197, 199, 211,
+	223, 227, 229, 233, 239, 241, 251, 257, 263, 269, 271, 277, 281, 283, 293}
+
+// Halton is a sampler that returns the points of the Halton sequence, one
+// prime base per dimension. Every pixel and dimension is shifted by its own
+// random offset (Cranley-Patterson rotation) so neighbouring pixels do not
+// repeat the same pattern. Dimensions past the last prime are uniformly
+// random.
+type Halton struct {
+	seed      int64
+	pixelSeed uint64
+	index     uint64
+	dimension int
+	rng       RNG
+}
+
+// NewHalton returns a new Halton sampler.
+func NewHalton(seed int64) *Halton {
+	return &Halton{seed: seed}
+}
+
+// StartSample ...
+func (h *Halton) StartSample(x, y, index int) {
+	h.pixelSeed = Hash(uint64(h.seed), uint64(x), uint64(y))
+	h.index = uint64(index)
+	h.dimension = 0
+	h.rng.Seed(Hash(h.pixelSeed, uint64(index)), 0)
+}
+
+// Get1D ...
+func (h *Halton) Get1D() float64 {
+	if h.dimension >= len(primes) {
+		return h.rng.Float64()
+	}
+	offset := float64(Hash(h.pixelSeed, uint64(h.dimension))>>11) / (1 << 53)
+	v := radicalInverse(h.index, primes[h.dimension]) + offset
+	h.dimension++
+	if v >= 1 {
+		v--
+	}
+	return math.Min(v, oneMinusEpsilon)
+}
+
+// Get2D ...
+func (h *Halton) Get2D() (float64, float64) {
+	x := h.Get1D()
+	return x, h.Get1D()
+}
+
+// Clone ...
+func (h *Halton) Clone() Sampler {
+	return &Halton{seed: h.seed}
+}
+
+func (h *Halton) String() string {
+	return fmt.Sprintf("halton seed=%d", h.seed)
+}
+
+// radicalInverse mirrors the digits of i in the given base around the decimal
+// point.
+func radicalInverse(i, base uint64) float64 {
+	inverse := 1 / float64(base)
+	reversed := uint64(0)
+	factor := 1.0
+	for i > 0 {
+		next := i / base
+		reversed = reversed*base + (i - next*base)
+		factor *= inverse
+		i = next
+	}
+	return math.Min(float64(reversed)*factor, oneMinusEpsilon)
+}
@@ -0,0 +1,55 @@
+package sampling
+
+// RNG is a PCG32 pseudo random number generator. Unlike the global math/rand
+// generator it is cheap to create and seed, so every sample can get its own
+// generator without locking.
+// [O'Neill, PCG: A Family of Simple Fast Space-Efficient Statistically Good
+// Algorithms for Random Number Generation]
+type RNG struct {
+	state, inc uint64
+}
+
+// NewRNG returns a generator seeded with seed on stream seq.
+func NewRNG(seed, seq uint64) *RNG {
+	r := &RNG{}
+	r.Seed(seed, seq)
+	return r
+}
+
+// Seed resets the generator to the start of the sequence given by seed on
+// stream seq.
+func (r *RNG) Seed(seed, seq uint64) {
+	r.state = 0
+	r.inc = seq<<1 | 1
+	r.Uint32()
+	r.state += seed
+	r.Uint32()
+}
+
+// Uint32 returns a uniformly distributed 32 bit integer.
+func (r *RNG) Uint32() uint32 {
+	old := r.state
+	r.state = old*6364136223846793005 + r.inc
+	xorShifted := uint32(((old >> 18) ^ old) >> 27)
+	rot := uint32(old >> 59)
+	return (xorShifted >> rot) | (xorShifted << ((-rot) & 31))
+}
+
+// Float64 returns a uniformly distributed number in [0, 1).
+func (r *RNG) Float64() float64 {
+	return float64(r.Uint32()) / (1 << 32)
+}
+
+// Hash mixes values into a single well distributed 64 bit value, which is
+// used to derive seeds from pixel coordinates and sample indices.
+func Hash(values ...uint64) uint64 {
+	h := uint64(0x9e3779b97f4a7c15)
+	for _, v := range values {
+		// splitmix64 finalizer
+		h ^= v + 0x9e3779b97f4a7c15 + (h << 6) + (h >> 2)
+		h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+		h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+		h ^= h >> 31
+	}
+	return h
+}
@@ -0,0 +1,74 @@
+package sampling
+
+import "fmt"
+
+// Sampler supplies the random numbers used to generate a camera sample and
+// follow its path. Every sample of every pixel starts from a state that only
+// depends on the seed, the pixel and the sample index, so renders are
+// reproducible regardless of how pixels are distributed over threads.
+type Sampler interface {
+	// StartSample prepares the sampler for sample index of pixel (x, y).
+	StartSample(x, y, index int)
+	// Get1D returns the next number in [0, 1).
+	Get1D() float64
+	// Get2D returns the next pair of numbers in [0, 1).
+	Get2D() (float64, float64)
+	// Clone returns an independent copy of the sampler for another worker.
+	Clone() Sampler
+	// String describes the sampler and its seed, the same for samplers that
+	// generate the same numbers. Checkpoints are only resumed with the
+	// sampler they were rendered with.
+	String() string
+}
+
+// Independent is a sampler that returns uniform pseudo random numbers.
+type Independent struct {
+	seed int64
+	rng  RNG
+}
+
+// NewIndependent returns a new independent sampler with the given seed.
+func NewIndependent(seed int64) *Independent {
+	return &Independent{seed: seed}
+}
+
+// StartSample ...
+func (s *Independent) StartSample(x, y, index int) {
+	s.rng.Seed(Hash(uint64(s.seed), uint64(index)), Hash(uint64(x), uint64(y)))
+}
+
+// Get1D ...
+func (s *Independent) Get1D() float64 {
+	return s.rng.Float64()
+}
+
+// Get2D ...
+func (s *Independent) Get2D() (float64, float64) {
+	return s.rng.Float64(), s.rng.Float64()
+}
+
+// Clone ...
+func (s *Independent) Clone() Sampler {
+	return &Independent{seed: s.seed}
+}
+
+func (s *Independent) String() string {
+	return fmt.Sprintf("independent seed=%d", s.seed)
+}
+
+// NewSampler returns the sampler with the given name: independent,
+// stratified, halton or sobol. spp is the number of samples per pixel the
+// sampler is expected to provide.
+func NewSampler(name string, seed int64, spp int) (Sampler, error) {
+	switch name {
+	case "independent":
+		return NewIndependent(seed), nil
+	case "stratified":
+		return NewStratified(seed, spp), nil
+	case "halton":
+		return NewHalton(seed), nil
+	case "sobol":
+		return NewSobol(seed), nil
+	}
+	return nil, fmt.Errorf("unknown sampler %q", name)
+}
@@ -0,0 +1,65 @@
+package sampling
+
+import "testing"
+
+func samplers(spp int) []Sampler {
+	return []Sampler{NewIndependent(3), NewStratified(3, spp), NewHalton(3), NewSobol(3)}
+}
+
+func TestSamplersAreDeterministic(t *testing.T) {
+	for _, s := range samplers(16) {
+		a, b := s.Clone(), s.Clone()
+		for k := 0; k < 16; k++ {
+			a.StartSample(4, 5, k)
+			b.StartSample(4, 5, k)
+			for d := 0; d < 8; d++ {
+				x1, y1 := a.Get2D()
+				x2, y2 := b.Get2D()
+				if x1 != x2 || y1 != y2 {
+					t.Fatalf("%v: sample %d dimension %d differs", s, k, d)
+				}
+				if x1 < 0 || x1 >= 1 || y1 < 0 || y1 >= 1 {
+					t.Fatalf("%v: sample (%v, %v) is outside [0, 1)", s, x1, y1)
+				}
+			}
+		}
+	}
+}
+
+// TestSamplersAreStratified checks that the first spp samples of a pixel put
+// exactly one sample in every one of spp intervals of each dimension.
+func TestSamplersAreStratified(t *testing.T) {
+	const spp = 16
+	for _, s := range []Sampler{NewStratified(3, spp), NewSobol(3)} {
+		for d := 0; d < 6; d++ {
+			var xs, ys [spp]int
+			for k := 0; k < spp; k++ {
+				s.StartSample(2, 9, k)
+				for i := 0; i < d; i++ {
+					s.Get1D()
+				}
+				x, y := s.Get2D()
+				xs[int(x*spp)]++
+				ys[int(y*spp)]++
+			}
+			for i := range xs {
+				if xs[i] != 1 || ys[i] != 1 {
+					t.Fatalf("%v: dimension %d is not stratified: %v %v", s, d, xs, ys)
+				}
+			}
+		}
+	}
+}
+
+func TestPermute(t *testing.T) {
+	for _, l := range []uint32{1, 5, 16, 100} {
+		seen := make([]bool, l)
+		for i := uint32(0); i < l; i++ {
+			p := permute(i, l, 0x1234567)
+			if p >= l || seen[p] {
+				t.Fatalf("permute(%d, %d) = %d is not a permutation", i, l, p)
+			}
+			seen[p] = true
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package sampling
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// oneMinusEpsilon is the largest float64 below one.
+const oneMinusEpsilon = 0x1.fffffffffffffp-1
+
+// sobolMatrices are the generator matrices of the first two dimensions of the
+// Sobol sequence, stored as one column per bit of the sample index.
+var sobolMatrices = func() [2][32]uint32 {
+	var m [2][32]uint32
+	for i := 0; i < 32; i++ {
+		m[0][i] = 1 << uint(31-i)
+	}
+	m[1][0] = 1 << 31
+	for i := 1; i < 32; i++ {
+		m[1][i] = m[1][i-1] ^ (m[1][i-1] >> 1)
+	}
+	return m
+}()
+
+// Sobol is a sampler that pads together the first two dimensions of the Sobol
+// sequence, which form a (0,2)-sequence. Every pair of dimensions visits the
+// points in a different shuffled order and every dimension is Owen scrambled
+// with hashing, so pixels and dimensions are decorrelated while the points of
+// a pixel stay well stratified.
+// [Burley, Practical Hash-based Owen Scrambling]
+type Sobol struct {
+	seed      int64
+	pixelSeed uint64
+	index     uint32
+	dimension uint64
+}
+
+// NewSobol returns a new scrambled Sobol sampler.
+func NewSobol(seed int64) *Sobol {
+	return &Sobol{seed: seed}
+}
+
+// StartSample ...
+func (s *Sobol) StartSample(x, y, index int) {
+	s.pixelSeed = Hash(uint64(s.seed), uint64(x), uint64(y))
+	s.index = uint32(index)
+	s.dimension = 0
+}
+
+// Get1D ...
+func (s *Sobol) Get1D() float64 {
+	seed := Hash(s.pixelSeed, s.dimension)
+	s.dimension++
+	index := nestedUniformScramble(s.index, uint32(seed))
+	return toUnit(nestedUniformScramble(sobol(index, 0), uint32(seed>>32)))
+}
+
+// Get2D ...
+func (s *Sobol) Get2D() (float64, float64) {
+	seed := Hash(s.pixelSeed, s.dimension)
+	s.dimension++
+	index := nestedUniformScramble(s.index, uint32(seed))
+	x := nestedUniformScramble(sobol(index, 0), uint32(seed>>32))
+	y := nestedUniformScramble(sobol(index, 1), uint32(Hash(seed)))
+	return toUnit(x), toUnit(y)
+}
+
+// Clone ...
+func (s *Sobol) Clone() Sampler {
+	return &Sobol{seed: s.seed}
+}
+
+func (s *Sobol) String() string {
+	return fmt.Sprintf("sobol seed=%d", s.seed)
+}
+
+// sobol returns the point with the given index of a dimension of the Sobol
+// sequence as a 32 bit fixed point number.
+func sobol(index uint32, dimension int) uint32 {
+	v := uint32(0)
+	for i := 0; index != 0; i, index = i+1, index>>1 {
+		if index&1 != 0 {
+			v ^= sobolMatrices[dimension][i]
+		}
+	}
+	return v
+}
+
+// nestedUniformScramble applies an Owen scramble selected by seed to the
+// 32 bit fixed point number x.
+func nestedUniformScramble(x, seed uint32) uint32 {
+	x = bits.Reverse32(x)
+	x += seed
+	x ^= x * 0x6c50b47c
+	x ^= x * 0xb82f1e52
+	x ^= x * 0xc7afe638
+	x ^= x * 0x8d22f6e6
+	return bits.Reverse32(x)
+}
+
+func toUnit(x uint32) float64 {
+	return float64(x) / (1 << 32)
+}
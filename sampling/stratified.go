@@ -0,0 +1,115 @@
+package sampling
+
+import (
+	"fmt"
+	"math"
+)
+
+// Stratified is a sampler that splits every dimension into spp strata and
+// places one jittered sample in each. The strata are visited in a different
+// random order for every pixel and dimension so the dimensions stay
+// uncorrelated. Samples past spp are uniformly random.
+type Stratified struct {
+	seed      int64
+	spp       int
+	pixelSeed uint64
+	index     int
+	dimension uint64
+	rng       RNG
+}
+
+// NewStratified returns a new stratified sampler for spp samples per pixel.
+func NewStratified(seed int64, spp int) *Stratified {
+	if spp < 1 {
+		spp = 1
+	}
+	return &Stratified{seed: seed, spp: spp}
+}
+
+// StartSample ...
+func (s *Stratified) StartSample(x, y, index int) {
+	s.pixelSeed = Hash(uint64(s.seed), uint64(x), uint64(y))
+	s.index = index
+	s.dimension = 0
+	s.rng.Seed(Hash(s.pixelSeed, uint64(index)), 0)
+}
+
+// Get1D ...
+func (s *Stratified) Get1D() float64 {
+	s.dimension++
+	if s.index >= s.spp {
+		return s.rng.Float64()
+	}
+	stratum := s.stratum(s.dimension)
+	return (float64(stratum) + s.rng.Float64()) / float64(s.spp)
+}
+
+// Get2D ...
+func (s *Stratified) Get2D() (float64, float64) {
+	s.dimension++
+	if s.index >= s.spp {
+		return s.rng.Float64(), s.rng.Float64()
+	}
+	// Correlated multi-jittering: the samples fill an m by n grid of cells and
+	// are also stratified along each axis on its own.
+	// [Kensler, Correlated Multi-Jittered Sampling]
+	p := uint32(Hash(s.pixelSeed, s.dimension))
+	m := uint32(math.Sqrt(float64(s.spp)))
+	n := (uint32(s.spp) + m - 1) / m
+	stratum := permute(uint32(s.index), uint32(s.spp), p*0x51633e2d)
+	sx := permute(stratum%m, m, p*0x68bc21eb)
+	sy := permute(stratum/m, n, p*0x02e5be93)
+	x := (float64(stratum%m) + (float64(sy)+s.rng.Float64())/float64(n)) / float64(m)
+	y := (float64(stratum/m) + (float64(sx)+s.rng.Float64())/float64(m)) / float64(n)
+	return x, y
+}
+
+// Clone ...
+func (s *Stratified) Clone() Sampler {
+	return &Stratified{seed: s.seed, spp: s.spp}
+}
+
+func (s *Stratified) String() string {
+	return fmt.Sprintf("stratified seed=%d spp=%d", s.seed, s.spp)
+}
+
+// stratum returns the stratum the current sample falls in along dimension.
+func (s *Stratified) stratum(dimension uint64) int {
+	return int(permute(uint32(s.index), uint32(s.spp), uint32(Hash(s.pixelSeed, dimension))))
+}
+
+// permute returns the element at position i of a random permutation of
+// [0, l) selected by p, without storing the permutation.
+// [Kensler, Correlated Multi-Jittered Sampling]
+func permute(i, l, p uint32) uint32 {
+	w := l - 1
+	w |= w >> 1
+	w |= w >> 2
+	w |= w >> 4
+	w |= w >> 8
+	w |= w >> 16
+	for {
+		i ^= p
+		i *= 0xe170893d
+		i ^= p >> 16
+		i ^= (i & w) >> 4
+		i ^= p >> 8
+		i *= 0x0929eb3f
+		i ^= p >> 23
+		i ^= (i & w) >> 1
+		i *= 1 | p>>27
+		i *= 0x6935fa69
+		i ^= (i & w) >> 11
+		i *= 0x74dcb303
+		i ^= (i & w) >> 2
+		i *= 0x9e501cc3
+		i ^= (i & w) >> 2
+		i *= 0xc860a3df
+		i &= w
+		i ^= i >> 5
+		if i < l {
+			break
+		}
+	}
+	return (i + p) % l
+}
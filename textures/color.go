@@ -31,10 +31,10 @@ func NewEmptyColor() Color {
 	return Color{0, 0, 0}
 }
 
-// NewRandomColor returns a random color.
-func NewRandomColor() Color {
-	return Color{rand.Float64() * rand.Float64(), rand.Float64() * rand.Float64(),
-		rand.Float64() * rand.Float64()}
+// NewRandomColor returns a random color drawn from rng.
+func NewRandomColor(rng *rand.Rand) Color {
+	return Color{rng.Float64() * rng.Float64(), rng.Float64() * rng.Float64(),
+		rng.Float64() * rng.Float64()}
 }
 
 // GetColor is used to have colors implment the texture interface. This allows
@@ -89,6 +89,12 @@ func (c Color) DivideScalar(f float64) Color {
 	return Color{c.R / f, c.G / f, c.B / f}
 }
 
+// Luminance returns the relative luminance of the color using the Rec. 709
+// primaries.
+func (c Color) Luminance() float64 {
+	return 0.2126*c.R + 0.7152*c.G + 0.0722*c.B
+}
+
 // Gradient returns a gradient of blue + white.
 func Gradient(t float64) Color {
 	return White.MultiplyScalar(1.0 - t).Add(Blue.MultiplyScalar(t))
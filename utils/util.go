@@ -2,8 +2,8 @@ package utils
 
 import (
 	"math"
-	"math/rand"
 	"raytracer/primitives"
+	"raytracer/sampling"
 )
 
 // GetSphereUV corresponding u, v coordinates in the image plane.
@@ -15,28 +15,42 @@ func GetSphereUV(p primitives.Vec3) (float64, float64) {
 	return u, v
 }
 
-// RandomInUnitSphere returns a point in the unit sphere.
-func RandomInUnitSphere() primitives.Vec3 {
-	v2 := primitives.NewVec3(1, 1, 1)
-	for {
-		p := primitives.NewVec3(rand.Float64(), rand.Float64(), rand.Float64()).
-			MultiplyScalar(2.0).Subtract(v2)
-		if p.SquaredMagnitude() < 1.0 {
-			return p
-		}
-	}
+// RandomInUnitSphere returns a point uniformly distributed in the unit
+// sphere.
+func RandomInUnitSphere(sampler sampling.Sampler) primitives.Vec3 {
+	return RandomOnUnitSphere(sampler).MultiplyScalar(math.Cbrt(sampler.Get1D()))
+}
+
+// RandomOnUnitSphere returns a point uniformly distributed on the surface of
+// the unit sphere.
+func RandomOnUnitSphere(sampler sampling.Sampler) primitives.Vec3 {
+	u1, u2 := sampler.Get2D()
+	z := 1 - 2*u1
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := 2 * math.Pi * u2
+	return primitives.NewVec3(r*math.Cos(phi), r*math.Sin(phi), z)
 }
 
-// RandomInUnitDisk returns a point in the unit disk.
-func RandomInUnitDisk() primitives.Vec3 {
-	v2 := primitives.NewVec3(1, 1, 0)
-	for {
-		p := primitives.NewVec3(rand.Float64(), rand.Float64(), 0).
-			MultiplyScalar(2.0).Subtract(v2)
-		if p.SquaredMagnitude() < 1.0 {
-			return p
-		}
+// RandomInUnitDisk returns a point uniformly distributed in the unit disk
+// using the concentric mapping, which keeps well distributed samples well
+// distributed.
+// [Shirley and Chiu, A Low Distortion Map Between Disk and Square]
+func RandomInUnitDisk(sampler sampling.Sampler) primitives.Vec3 {
+	u1, u2 := sampler.Get2D()
+	a := 2*u1 - 1
+	b := 2*u2 - 1
+	if a == 0 && b == 0 {
+		return primitives.NewVec3(0, 0, 0)
 	}
+	var r, theta float64
+	if math.Abs(a) > math.Abs(b) {
+		r = a
+		theta = math.Pi / 4 * (b / a)
+	} else {
+		r = b
+		theta = math.Pi/2 - math.Pi/4*(a/b)
+	}
+	return primitives.NewVec3(r*math.Cos(theta), r*math.Sin(theta), 0)
 }
 
 // Schlick angle reflection approximation for s a formula for approximating the
@@ -48,3 +62,41 @@ func Schlick(cosine, reflectIdx float64) float64 {
 	r0 *= r0
 	return r0 + (1-r0)*math.Pow(1-cosine, 5)
 }
+
+// OrthonormalBasis returns two unit vectors that together with the unit vector
+// n form an orthonormal basis.
+func OrthonormalBasis(n primitives.Vec3) (primitives.Vec3, primitives.Vec3) {
+	a := primitives.UnitX
+	if math.Abs(n.X()) > 0.9 {
+		a = primitives.UnitY
+	}
+	t := n.Cross(a).Normalize()
+	s := t.Cross(n)
+	return s, t
+}
+
+// RandomCosineDirection returns a direction in the hemisphere around the unit
+// vector n distributed proportionally to the cosine with n.
+func RandomCosineDirection(n primitives.Vec3, sampler sampling.Sampler) primitives.Vec3 {
+	r1, r2 := sampler.Get2D()
+	phi := 2 * math.Pi * r1
+	r := math.Sqrt(r2)
+	z := math.Sqrt(1 - r2)
+	s, t := OrthonormalBasis(n)
+	return s.MultiplyScalar(r * math.Cos(phi)).
+		Add(t.MultiplyScalar(r * math.Sin(phi))).
+		Add(n.MultiplyScalar(z))
+}
+
+// PowerHeuristic returns the multiple importance sampling weight of a sample
+// taken with nf samples from a strategy with density fPdf, when combined with
+// ng samples from a strategy with density gPdf.
+// [Veach, Robust Monte Carlo Methods for Light Transport Simulation, 9.2.4]
+func PowerHeuristic(nf int, fPdf float64, ng int, gPdf float64) float64 {
+	f := float64(nf) * fPdf
+	g := float64(ng) * gPdf
+	if f == 0 {
+		return 0
+	}
+	return (f * f) / (f*f + g*g)
+}